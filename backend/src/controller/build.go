@@ -38,6 +38,8 @@ type buildResult struct {
 	errorMessage string
 	// vetOut is the output of go vet, if requested.
 	vetOut string
+	// diagnosticsOut is the output of go build -gcflags=-m, if requested.
+	diagnosticsOut string
 }
 
 // cleanup cleans up the temporary goPath created when building with module support.
@@ -48,10 +50,18 @@ func (b *buildResult) cleanup() error {
 	return nil
 }
 
+// BuildOptions controls how the user program is built
+type BuildOptions struct {
+	// Race builds the program with the race detector enabled
+	Race bool
+	// Diagnostics also compiles the program with -gcflags=-m to get the escape analysis and inlining decisions
+	Diagnostics bool
+}
+
 // sandboxBuild builds a Go program and returns a build result that includes the build context.
 //
 // An error is returned if a non-user-correctable error has occurred.
-func (c *Controller) sandboxBuild(ctx context.Context, tmpDir string, in []byte, vet bool) (br *buildResult, err error) {
+func (c *Controller) sandboxBuild(ctx context.Context, tmpDir string, in []byte, vet bool, opts BuildOptions) (br *buildResult, err error) {
 	files, err := txtar.SplitFiles(in)
 	if err != nil {
 		return &buildResult{errorMessage: err.Error()}, nil
@@ -129,12 +139,18 @@ func (c *Controller) sandboxBuild(ctx context.Context, tmpDir string, in []byte,
 		goArgs = append(goArgs, "build")
 	}
 	goArgs = append(goArgs, "-o", br.exePath, "-tags=faketime")
+	cgoEnabled := "0"
+	if opts.Race {
+		// the race detector runtime is linked through cgo
+		goArgs = append(goArgs, "-race")
+		cgoEnabled = "1"
+	}
 
 	cmd := exec.Command("/usr/local/go-faketime/bin/go", goArgs...)
 	cmd.Dir = tmpDir
 	cmd.Env = []string{"GOOS=linux", "GOARCH=amd64", "GOROOT=/usr/local/go-faketime"}
 	cmd.Env = append(cmd.Env, "GOCACHE="+goCache)
-	cmd.Env = append(cmd.Env, "CGO_ENABLED=0")
+	cmd.Env = append(cmd.Env, "CGO_ENABLED="+cgoEnabled)
 	cmd.Env = append(cmd.Env, "GOEXPERIMENT="+strings.Join(exp, ","))
 	// Create a GOPATH just for modules to be downloaded
 	// into GOPATH/pkg/mod.
@@ -180,6 +196,12 @@ func (c *Controller) sandboxBuild(ctx context.Context, tmpDir string, in []byte,
 		}
 		return nil, fmt.Errorf("invalid binary size %d", fi.Size())
 	}
+	if opts.Diagnostics {
+		br.diagnosticsOut, err = compilerDiagnosticsInDir(ctx, tmpDir, cmd.Env)
+		if err != nil {
+			return nil, fmt.Errorf("running compiler diagnostics: %v", err)
+		}
+	}
 	if vet {
 		// TODO: do this concurrently with the execution to reduce latency.
 		br.vetOut, err = vetCheckInDir(ctx, tmpDir, br.goPath, exp)
@@ -190,6 +212,19 @@ func (c *Controller) sandboxBuild(ctx context.Context, tmpDir string, in []byte,
 	return br, nil
 }
 
+// compilerDiagnosticsInDir compiles the program in dir again with optimizations and -gcflags=-m, in the
+// environment of the sandbox build, and returns the escape analysis and inlining decisions it printed.
+func compilerDiagnosticsInDir(ctx context.Context, dir string, env []string) (string, error) {
+	cmd := exec.CommandContext(ctx, "/usr/local/go-faketime/bin/go", "build", "-o", os.DevNull, "-tags=faketime", "-gcflags=-m", "-modcacherw", "-mod=mod", ".")
+	cmd.Dir = dir
+	cmd.Env = env
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s%w", out, err)
+	}
+	return strings.Replace(string(out), dir+"/", "", -1), nil
+}
+
 func outputContainsError(output string) (string, bool) {
 	if strings.Contains(output, "failed to build binary") {
 		startLoc := strings.Index(output, "data/main.go")
@@ -200,6 +235,10 @@ func outputContainsError(output string) (string, bool) {
 		return output[startLoc : endLoc-2], true
 	} else if strings.Contains(output, "limit reached") {
 		return "failed to get execution steps: limit reached", true
+	} else if startLoc := strings.Index(output, "failed to expand variable"); startLoc != -1 {
+		message, _, _ := strings.Cut(output[startLoc:], "\n")
+		message, _, _ = strings.Cut(message, `"`)
+		return message, true
 	}
 	return output, false
 }
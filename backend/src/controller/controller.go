@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/ahmedakef/gotutor/backend/src/cache"
@@ -40,15 +41,123 @@ func NewController(logger zerolog.Logger, cache cache.LRUCache, db *db.DB) *Cont
 	}
 }
 
-// GetExecutionSteps gets the execution steps for the given source code
-func (c *Controller) GetExecutionSteps(ctx context.Context, sourceCode string) (serialize.ExecutionResponse, error) {
+// _maxLoadLimits caps the load limits a request can ask for, to bound the size of the traces
+var _maxLoadLimits = serialize.LoadLimits{
+	MaxVariableRecurse: 5,
+	MaxStringLen:       1024,
+	MaxArrayValues:     100,
+	MaxStructFields:    50,
+}
+
+// _maxGOMAXPROCS caps the GOMAXPROCS a request can ask for, the containers are limited to a few CPUs anyway
+const _maxGOMAXPROCS = 8
+
+// TraceOptions controls what the serializer records while tracing the program
+type TraceOptions struct {
+	// StepInto lists the standard library packages whose frames are recorded like user code
+	StepInto []string
+	// Load bounds how much of every variable is loaded, it's capped to _maxLoadLimits
+	Load serialize.LoadLimits
+	// MemStats records the heap and GC statistics every MemStats steps, 0 disables them
+	MemStats int
+	// Scheduler records the OS threads at every step with the processors they hold and the goroutines they run
+	Scheduler bool
+	// GOMAXPROCS of the traced program, 0 keeps the runtime's default, it's capped to _maxGOMAXPROCS
+	GOMAXPROCS int
+	// Deterministic records the same steps on every run: GOMAXPROCS=1, a fixed random seed and faketime
+	Deterministic bool
+	// Disassemble records the machine code of the functions and references the instructions of every step's line
+	Disassemble bool
+	// Slices records the slice headers held by the variables, grouped by backing array
+	Slices bool
+	// Closures decodes the function values held by the variables into their function and captured variables
+	Closures bool
+	// Truncated lists the variables cut off by the load limits on every step, to be loaded again by ExpandVariable
+	Truncated bool
+	// Scopes records the declaring block of the locals, whether they are in scope and the variables they shadow
+	Scopes bool
+	// Interfaces records the dynamic type, nil state and implemented methods of the interface values
+	Interfaces bool
+	// Formatted shows the values of the types with a formatter, built in or declared in the source, as a list, a tree or text
+	Formatted bool
+	// LoopsUnderLimit doesn't count the loop iterations past LoopHead against the steps limit, for the loops to be collapsed afterwards
+	LoopsUnderLimit bool
+	LoopHead        int
+}
+
+// args returns the gotutor flags for the options
+func (o TraceOptions) args() []string {
+	var args []string
+	if len(o.StepInto) > 0 {
+		args = append(args, "--step-into="+strings.Join(o.StepInto, ","))
+	}
+	if o.MemStats > 0 {
+		args = append(args, fmt.Sprintf("--mem-stats=%d", o.MemStats))
+	}
+	if o.Scheduler {
+		args = append(args, "--scheduler")
+	}
+	if o.GOMAXPROCS > 0 {
+		args = append(args, fmt.Sprintf("--gomaxprocs=%d", min(o.GOMAXPROCS, _maxGOMAXPROCS)))
+	}
+	if o.Deterministic {
+		args = append(args, "--deterministic")
+	}
+	if o.Disassemble {
+		args = append(args, "--disassemble")
+	}
+	if o.Slices {
+		args = append(args, "--slices")
+	}
+	if o.Closures {
+		args = append(args, "--closures")
+	}
+	if o.Truncated {
+		args = append(args, "--truncated")
+	}
+	if o.Scopes {
+		args = append(args, "--scopes")
+	}
+	if o.Interfaces {
+		args = append(args, "--interfaces")
+	}
+	if o.Formatted {
+		args = append(args, "--formatted")
+	}
+	if o.LoopsUnderLimit {
+		args = append(args, "--loops-under-limit", fmt.Sprintf("--loop-head=%d", o.LoopHead))
+	}
+	if load := o.Load.Capped(_maxLoadLimits); load != serialize.DefaultLoadLimits {
+		args = append(args,
+			fmt.Sprintf("--max-variable-recurse=%d", load.MaxVariableRecurse),
+			fmt.Sprintf("--max-string-len=%d", load.MaxStringLen),
+			fmt.Sprintf("--max-array-values=%d", load.MaxArrayValues),
+			fmt.Sprintf("--max-struct-fields=%d", load.MaxStructFields),
+		)
+	}
+	return args
+}
+
+// cacheKey identifies the trace of the source code recorded with the options
+func (o TraceOptions) cacheKey(sourceCode string) string {
+	args := o.args()
+	if len(args) == 0 {
+		return sourceCode
+	}
+	return sourceCode + "\x00" + strings.Join(args, " ")
+}
+
+// GetExecutionSteps gets the execution steps for the given source code. It doesn't build with the race detector
+// like Compile can: the tracer image has no C toolchain, which the race detector needs for cgo.
+func (c *Controller) GetExecutionSteps(ctx context.Context, sourceCode string, opts TraceOptions) (serialize.ExecutionResponse, error) {
 	_, err := c.db.IncrementCallCounter(db.GetExecutionSteps)
 	if err != nil {
 		c.logger.Err(err).Msg("failed to increment call counter")
 	}
 
 	// check if the request is already in the cache
-	cachedResponse, ok := c.cache.Get(sourceCode)
+	cacheKey := opts.cacheKey(sourceCode)
+	cachedResponse, ok := c.cache.Get(cacheKey)
 	if ok {
 		c.logger.Info().Msg("cache hit")
 		return cachedResponse, nil
@@ -63,9 +172,47 @@ func (c *Controller) GetExecutionSteps(ctx context.Context, sourceCode string) (
 		c.logger.Err(err).Msg("failed to save source code")
 	}
 
+	output, err := c.runTracer(ctx, sourceCode, opts.args())
+	if err != nil {
+		return serialize.ExecutionResponse{}, err
+	}
+	var response serialize.ExecutionResponse
+	err = json.Unmarshal(output, &response)
+	if err != nil {
+		return serialize.ExecutionResponse{}, fmt.Errorf("failed to decode output: %w", err)
+	}
+
+	c.cache.Set(cacheKey, response)
+	return response, nil
+}
+
+// ExpandVariable loads a variable of a step of the program again with the load limits of the options,
+// usually higher than the ones the steps were recorded with, by tracing the program up to that step
+func (c *Controller) ExpandVariable(ctx context.Context, sourceCode string, opts TraceOptions, req serialize.ExpandRequest) (json.RawMessage, error) {
+	_, err := c.db.IncrementCallCounter(db.ExpandVariable)
+	if err != nil {
+		c.logger.Err(err).Msg("failed to increment call counter")
+	}
+
+	if err := c.sem.Acquire(ctx, 1); err != nil {
+		return nil, fmt.Errorf("failed to acquire semaphore: %w", err)
+	}
+	defer c.sem.Release(1)
+
+	args := append(opts.args(),
+		"--expand="+req.Expression,
+		fmt.Sprintf("--expand-step=%d", req.Step),
+		fmt.Sprintf("--expand-goroutine=%d", req.Goroutine),
+		fmt.Sprintf("--expand-frame=%d", req.Frame),
+	)
+	return c.runTracer(ctx, sourceCode, args)
+}
+
+// runTracer traces the source code in a container with the given gotutor flags and returns the output it wrote
+func (c *Controller) runTracer(ctx context.Context, sourceCode string, args []string) ([]byte, error) {
 	tmpDir, err := os.MkdirTemp("", "sandbox")
 	if err != nil {
-		return serialize.ExecutionResponse{}, fmt.Errorf("error creating temp directory: %v", err)
+		return nil, fmt.Errorf("error creating temp directory: %v", err)
 	}
 
 	defer func() {
@@ -77,7 +224,7 @@ func (c *Controller) GetExecutionSteps(ctx context.Context, sourceCode string) (
 	sourcePath := fmt.Sprintf("%s/main.go", tmpDir)
 	err = writeSourceCodeToFile(sourcePath, sourceCode)
 	if err != nil {
-		return serialize.ExecutionResponse{}, fmt.Errorf("failed to write source code to file: %w", err)
+		return nil, fmt.Errorf("failed to write source code to file: %w", err)
 	}
 
 	sourceCodeMapping := fmt.Sprintf("%s:/data/main.go", sourcePath)
@@ -85,14 +232,16 @@ func (c *Controller) GetExecutionSteps(ctx context.Context, sourceCode string) (
 	deadlineCtx, cancel := context.WithTimeout(ctx, 300*time.Second)
 	defer cancel()
 	containerName := fmt.Sprintf("gotutor-%s", filepath.Base(tmpDir))
-	dockerCommand := exec.CommandContext(deadlineCtx, "docker", "run", "--rm",
+	dockerArgs := []string{"run", "--rm",
 		"--name", containerName,
 		"--network", "none",
 		"--cpus", "1",
 		"--memory", "512m",
 		"--pids-limit", "256",
 		"-v", sourceCodeMapping, "-v", outputMapping,
-		"ahmedakef/gotutor", "debug", "/data/main.go")
+		// faketime like the sandbox build, sleeping goroutines don't use up the deadline
+		"ahmedakef/gotutor", "debug", "--faketime", "/data/main.go"}
+	dockerCommand := exec.CommandContext(deadlineCtx, "docker", append(dockerArgs, args...)...)
 	// CommandContext only kills the docker CLI client when ctx is cancelled;
 	// the container keeps running under dockerd. Stop the container explicitly.
 	dockerCommand.Cancel = func() error {
@@ -108,30 +257,21 @@ func (c *Controller) GetExecutionSteps(ctx context.Context, sourceCode string) (
 		_ = exec.CommandContext(killCtx, "docker", "kill", containerName).Run()
 	}()
 	if err != nil {
-		return serialize.ExecutionResponse{}, fmt.Errorf("failed to run docker command: %w : %s", err, string(dockerOut))
+		return nil, fmt.Errorf("failed to run docker command: %w : %s", err, string(dockerOut))
 	}
 	if outputSanitized, ok := outputContainsError(string(dockerOut)); ok {
-		return serialize.ExecutionResponse{}, errors.New(outputSanitized)
+		return nil, errors.New(outputSanitized)
 	}
 
-	stepsFile, err := os.Open(fmt.Sprintf("%s/steps.json", tmpDir))
-	if err != nil {
-		return serialize.ExecutionResponse{}, fmt.Errorf("failed to read output file: %w, dockerOut: %s", err, string(dockerOut))
-	}
-	defer stepsFile.Close()
-	// decode the output
-	var response serialize.ExecutionResponse
-	err = json.NewDecoder(stepsFile).Decode(&response)
+	output, err := os.ReadFile(fmt.Sprintf("%s/steps.json", tmpDir))
 	if err != nil {
-		return serialize.ExecutionResponse{}, fmt.Errorf("failed to decode output: %w", err)
+		return nil, fmt.Errorf("failed to read output file: %w, dockerOut: %s", err, string(dockerOut))
 	}
-
-	c.cache.Set(sourceCode, response)
-	return response, nil
+	return output, nil
 }
 
 // Compile compiles the given source code
-func (c *Controller) Compile(ctx context.Context, sourceCode string) (*serialize.ExecutionResponse, error) {
+func (c *Controller) Compile(ctx context.Context, sourceCode string, opts BuildOptions, traceOpts TraceOptions) (*serialize.ExecutionResponse, error) {
 	_, err := c.db.IncrementCallCounter(db.Compile)
 	if err != nil {
 		c.logger.Err(err).Msg("failed to increment call counter")
@@ -153,7 +293,7 @@ func (c *Controller) Compile(ctx context.Context, sourceCode string) (*serialize
 		}
 	}()
 
-	br, err := c.sandboxBuild(ctx, tmpDir, []byte(sourceCode), false)
+	br, err := c.sandboxBuild(ctx, tmpDir, []byte(sourceCode), false, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build: %w", err)
 	}
@@ -162,7 +302,7 @@ func (c *Controller) Compile(ctx context.Context, sourceCode string) (*serialize
 	}
 
 	br.goPath = tmpDir // temporary workaround to get the source code path
-	runRes, err := c.sandboxRun(ctx, br, br.testParam)
+	runRes, err := c.sandboxRun(ctx, br, br.testParam, traceOpts.args())
 	if err != nil {
 		return nil, err
 	}
@@ -185,13 +325,25 @@ func (c *Controller) Compile(ctx context.Context, sourceCode string) (*serialize
 		return nil, fmt.Errorf("error decoding events: %v", err)
 	}
 
+	// the serializer already stripped the playback headers from the output attached to the steps
 	stdout, stderr := convertEventsToStdoutStderr(events)
-	return &serialize.ExecutionResponse{
+	response := &serialize.ExecutionResponse{
 		Steps:    execRes.Steps,
 		Duration: execRes.Duration,
 		StdOut:   stdout,
 		StdErr:   stderr,
-	}, nil
+		Leaks:    execRes.Leaks,
+
+		Disassembly: execRes.Disassembly,
+		Metadata:    execRes.Metadata,
+	}
+	// the races were attached to the output with playback headers, attach them again to the decoded one
+	serialize.AttachRaces(response)
+	if br.diagnosticsOut != "" {
+		response.Diagnostics = serialize.ParseCompilerDiagnostics(br.diagnosticsOut)
+		serialize.AttachDiagnostics(response)
+	}
+	return response, nil
 }
 
 func convertEventsToStdoutStderr(events []Event) (stdout, stderr string) {
@@ -57,7 +57,7 @@ func TestGetExecutionSteps(t *testing.T) {
 			tt.setupCache(tp.cache)
 
 			ctx := context.Background()
-			resp, err := controller.GetExecutionSteps(ctx, tt.sourceCode)
+			resp, err := controller.GetExecutionSteps(ctx, tt.sourceCode, TraceOptions{})
 			if tt.expectError {
 				if err == nil {
 					t.Fatalf("expected error, got nil")
@@ -99,7 +99,7 @@ func TestCompile(t *testing.T) {
 			defer os.RemoveAll(tp.tmpDir)
 			controller := NewController(tp.logger, tp.cache, tp.db)
 
-			resp, err := controller.Compile(context.Background(), tt.sourceCode)
+			resp, err := controller.Compile(context.Background(), tt.sourceCode, BuildOptions{}, TraceOptions{})
 			if tt.expectError != nil {
 				assert.Error(t, err)
 				assert.Equal(t, tt.expectError, err)
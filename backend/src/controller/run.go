@@ -23,7 +23,7 @@ const (
 )
 
 // sandboxRun runs a Go binary in a sandbox environment.
-func (c *Controller) sandboxRun(ctx context.Context, br *buildResult, testParam string) (execRes sandboxtypes.Response, err error) {
+func (c *Controller) sandboxRun(ctx context.Context, br *buildResult, testParam string, args []string) (execRes sandboxtypes.Response, err error) {
 
 	exeBytes, err := os.ReadFile(br.exePath)
 	if err != nil {
@@ -53,6 +53,9 @@ func (c *Controller) sandboxRun(ctx context.Context, br *buildResult, testParam
 	if testParam != "" {
 		sreq.Header.Add("X-Argument", testParam)
 	}
+	for _, arg := range args {
+		sreq.Header.Add("X-Argument", arg)
+	}
 	sreq.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(exeBytes)), nil }
 	res, err := http.DefaultClient.Do(sreq)
 	if err != nil {
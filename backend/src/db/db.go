@@ -18,6 +18,7 @@ const (
 	FixCode           = "FixCode"
 	Compile           = "Compile"
 	Format            = "Format"
+	ExpandVariable    = "ExpandVariable"
 	SourceCodeBucket  = "SourceCode"
 	EmailsBucket      = "Emails"
 	CodeKey           = "code"
@@ -3,12 +3,15 @@ package handler
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 
 	"github.com/ahmedakef/gotutor/backend/src/controller"
 	"github.com/ahmedakef/gotutor/backend/src/db"
 	"github.com/ahmedakef/gotutor/backend/src/metrics"
+	"github.com/ahmedakef/gotutor/serialize"
 	"github.com/rs/zerolog"
 )
 
@@ -71,9 +74,121 @@ func (h *Handler) HandleHealthz(w http.ResponseWriter, _ *http.Request) {
 	_, _ = w.Write([]byte("ok"))
 }
 
+// LoadLimits bounds how much of every variable is loaded, zero fields keep the default limit
+// and the server caps the rest, variables cut off by the limits can be loaded with ExpandVariable
+type LoadLimits struct {
+	MaxVariableRecurse int `json:"max_variable_recurse"`
+	MaxStringLen       int `json:"max_string_len"`
+	MaxArrayValues     int `json:"max_array_values"`
+	MaxStructFields    int `json:"max_struct_fields"`
+}
+
+func (l LoadLimits) limits() serialize.LoadLimits {
+	return serialize.LoadLimits{
+		MaxVariableRecurse: l.MaxVariableRecurse,
+		MaxStringLen:       l.MaxStringLen,
+		MaxArrayValues:     l.MaxArrayValues,
+		MaxStructFields:    l.MaxStructFields,
+	}
+}
+
+// TraceFlags controls what the serializer records while tracing the program
+type TraceFlags struct {
+	// StepInto lists the standard library packages whose frames are recorded like user code, e.g. ["sort"]
+	StepInto []string `json:"step_into"`
+	LoadLimits
+	// MemStats records the heap and GC statistics every MemStats steps, 0 disables them
+	MemStats int `json:"mem_stats"`
+	// Disassemble adds the machine code of the functions and references the instructions of every step's line
+	Disassemble bool `json:"disassemble"`
+	// Scheduler records the OS threads at every step with the processors they hold and the goroutines they run
+	Scheduler bool `json:"scheduler"`
+	// GOMAXPROCS of the traced program, 0 keeps the runtime's default
+	GOMAXPROCS int `json:"gomaxprocs"`
+	// Deterministic records the same steps on every run, see Metadata in the response for how it was recorded
+	Deterministic bool `json:"deterministic"`
+	// Slices records the slice headers held by the variables, grouped by backing array
+	Slices bool `json:"slices"`
+	// Closures decodes the function values held by the variables into their function and captured variables
+	Closures bool `json:"closures"`
+	// Truncated lists the variables cut off by the load limits on every step, to be loaded again by ExpandVariable
+	Truncated bool `json:"truncated"`
+	// Scopes records the declaring block of the locals, whether they are in scope and the variables they shadow
+	Scopes bool `json:"scopes"`
+	// Interfaces records the dynamic type, nil state and implemented methods of the interface values
+	Interfaces bool `json:"interfaces"`
+	// Formatted shows the values of the types with a formatter, built in or declared in the source, as a list, a tree or text
+	Formatted bool `json:"formatted"`
+}
+
+func (f TraceFlags) traceOptions() controller.TraceOptions {
+	return controller.TraceOptions{
+		StepInto:      f.StepInto,
+		Load:          f.LoadLimits.limits(),
+		MemStats:      f.MemStats,
+		Disassemble:   f.Disassemble,
+		Scheduler:     f.Scheduler,
+		GOMAXPROCS:    f.GOMAXPROCS,
+		Deterministic: f.Deterministic,
+		Slices:        f.Slices,
+		Closures:      f.Closures,
+		Truncated:     f.Truncated,
+		Scopes:        f.Scopes,
+		Interfaces:    f.Interfaces,
+		Formatted:     f.Formatted,
+	}
+}
+
+// StepsFlags controls what is computed from the recorded steps and added to the response
+type StepsFlags struct {
+	// Stats adds line hit counts and function call counts to the response
+	Stats bool `json:"stats"`
+	// CallTree adds the tree of function calls to the response
+	CallTree bool `json:"call_tree"`
+	// CollapseLoops keeps only the first LoopHead and the last LoopTail iterations of every loop in full
+	CollapseLoops bool `json:"collapse_loops"`
+	LoopHead      int  `json:"loop_head"`
+	LoopTail      int  `json:"loop_tail"`
+}
+
+// traceLoops makes the trace not count the loop iterations collapsed by apply against the steps limit
+func (f StepsFlags) traceLoops(opts controller.TraceOptions) controller.TraceOptions {
+	if f.CollapseLoops {
+		opts.LoopsUnderLimit = true
+		opts.LoopHead = f.LoopHead
+	}
+	return opts
+}
+
+// apply adds the requested views to a copy of the response, the response itself may be shared through the cache
+func (f StepsFlags) apply(resp serialize.ExecutionResponse, sourceCode string) (serialize.ExecutionResponse, error) {
+	resp = resp.Clone()
+	if f.Stats {
+		stats := serialize.ComputeStats(resp.Steps)
+		resp.Stats = &stats
+	}
+	if f.CallTree {
+		// built before collapsing the loops so the calls made in the collapsed iterations are kept
+		resp.CallTree = serialize.BuildCallTree(resp.Steps)
+	}
+	if f.CollapseLoops {
+		err := serialize.CollapseLoops(&resp, []byte(sourceCode), f.LoopHead, f.LoopTail)
+		if err != nil {
+			return serialize.ExecutionResponse{}, err
+		}
+	}
+	return resp, nil
+}
+
 // GetExecutionStepsRequest is the request for the GetExecutionSteps method
 type GetExecutionStepsRequest struct {
 	SourceCode string `json:"source_code"`
+	// Format is the response format, one of json (default), text, markdown, dot or mermaid
+	Format string `json:"format"`
+	// Step is the index of the step rendered by the dot and mermaid formats
+	Step int `json:"step"`
+	StepsFlags
+	TraceFlags
 }
 
 // HandleGetExecutionSteps handles the GetExecutionSteps request
@@ -87,18 +202,134 @@ func (h *Handler) HandleGetExecutionSteps(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	resp, err := h.controller.GetExecutionSteps(r.Context(), req.SourceCode)
+	resp, err := h.controller.GetExecutionSteps(r.Context(), req.SourceCode, req.traceLoops(req.traceOptions()))
+	if err != nil {
+		h.respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp, err = req.apply(resp, req.SourceCode)
+	if err != nil {
+		h.respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.writeStepsResponse(w, resp, req.Format, req.Step)
+}
+
+// QueryExecutionStepsRequest is the request for the QueryExecutionSteps method
+type QueryExecutionStepsRequest struct {
+	SourceCode string `json:"source_code"`
+	// StepInto lists the standard library packages whose frames are recorded like user code, e.g. ["sort"]
+	StepInto []string `json:"step_into"`
+	LoadLimits
+	serialize.TraceQuery
+}
+
+// HandleQueryExecutionSteps answers a query about the execution steps of the source code,
+// like the values a variable had or the first step where an expression is true
+func (h *Handler) HandleQueryExecutionSteps(w http.ResponseWriter, r *http.Request) {
+	h.logRequest(r)
+
+	var req QueryExecutionStepsRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.respondWithError(w, "failed to decode request", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.controller.GetExecutionSteps(r.Context(), req.SourceCode, controller.TraceOptions{StepInto: req.StepInto, Load: req.LoadLimits.limits()})
 	if err != nil {
 		h.respondWithError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	h.writeJSONResponse(w, resp, http.StatusOK)
+	result, err := serialize.QueryTrace(resp.Steps, req.TraceQuery)
+	if err != nil {
+		h.respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.writeJSONResponse(w, result, http.StatusOK)
+}
+
+// ExpandVariableRequest is the request for the ExpandVariable method
+type ExpandVariableRequest struct {
+	SourceCode string `json:"source_code"`
+	// StepsFlags and TraceFlags must be the ones the steps were recorded with for the re-run to take the same steps,
+	// but for the load limits which are the ones the variable is loaded with
+	StepsFlags
+	TraceFlags
+	// Metadata is the one of the response the steps come from, when set the expansion is rejected
+	// if the re-run doesn't record the steps the same way
+	Metadata *serialize.Metadata `json:"metadata"`
+	// Step, Goroutine, Frame and Expression are copied from a truncated variable of the steps,
+	// Step is the index of the step before loops are collapsed and Expression is usually the variable's name
+	Step       int    `json:"step"`
+	Goroutine  int64  `json:"goroutine"`
+	Frame      int    `json:"frame"`
+	Expression string `json:"expression"`
+}
+
+// checkRecording tells why re-running the program with the options of the request wouldn't take the steps
+// described by its metadata, the expansions always run with faketime like the traces
+func (r ExpandVariableRequest) checkRecording() error {
+	if r.Metadata == nil {
+		return nil
+	}
+	if r.Deterministic != r.Metadata.Deterministic {
+		return fmt.Errorf("deterministic is %t but the steps were recorded with %t", r.Deterministic, r.Metadata.Deterministic)
+	}
+	if !r.Metadata.Faketime {
+		return errors.New("the steps were recorded without faketime")
+	}
+	if r.GOMAXPROCS > 0 && !r.Deterministic && r.GOMAXPROCS != r.Metadata.GOMAXPROCS {
+		return fmt.Errorf("gomaxprocs is %d but the steps were recorded with %d", r.GOMAXPROCS, r.Metadata.GOMAXPROCS)
+	}
+	return nil
+}
+
+// HandleExpandVariable loads a variable that was truncated in the execution steps again, with higher load limits
+func (h *Handler) HandleExpandVariable(w http.ResponseWriter, r *http.Request) {
+	h.logRequest(r)
+
+	var req ExpandVariableRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.respondWithError(w, "failed to decode request", http.StatusBadRequest)
+		return
+	}
+	if req.Expression == "" {
+		h.respondWithError(w, "expression is required", http.StatusBadRequest)
+		return
+	}
+	if err := req.checkRecording(); err != nil {
+		h.respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	variable, err := h.controller.ExpandVariable(r.Context(), req.SourceCode, req.traceLoops(req.traceOptions()),
+		serialize.ExpandRequest{Step: req.Step, Goroutine: req.Goroutine, Frame: req.Frame, Expression: req.Expression},
+	)
+	if err != nil {
+		h.respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSONResponse(w, variable, http.StatusOK)
 }
 
 // CompileRequest is the request for the Compile method
 type CompileRequest struct {
 	SourceCode string `json:"source_code"`
+	// Format is the response format, one of json (default), text, markdown, dot or mermaid
+	Format string `json:"format"`
+	// Step is the index of the step rendered by the dot and mermaid formats
+	Step int `json:"step"`
+	StepsFlags
+	TraceFlags
+	// Race builds the program with the race detector and attaches the data races to the steps,
+	// GetExecutionSteps has no such flag, see controller.GetExecutionSteps
+	Race bool `json:"race"`
+	// GCDiagnostics attaches the escape analysis and inlining decisions of the compiler to the steps of their lines
+	GCDiagnostics bool `json:"gc_diagnostics"`
 }
 
 // HandleCompile handles the Compile request
@@ -112,11 +343,61 @@ func (h *Handler) HandleCompile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err := h.controller.Compile(r.Context(), req.SourceCode)
+	resp, err := h.controller.Compile(r.Context(), req.SourceCode, controller.BuildOptions{Race: req.Race, Diagnostics: req.GCDiagnostics}, req.traceLoops(req.traceOptions()))
 	if err != nil {
 		h.respondWithError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	h.writeJSONResponse(w, resp, http.StatusOK)
+	steps, err := req.apply(*resp, req.SourceCode)
+	if err != nil {
+		h.respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.writeStepsResponse(w, steps, req.Format, req.Step)
+}
+
+// writeStepsResponse writes the execution steps in the requested format
+func (h *Handler) writeStepsResponse(w http.ResponseWriter, resp serialize.ExecutionResponse, format string, step int) {
+	if format == "" || format == "json" {
+		h.writeJSONResponse(w, resp, http.StatusOK)
+		return
+	}
+	if diagramFormat, err := serialize.ParseDiagramFormat(format); err == nil {
+		var buf bytes.Buffer
+		if err := serialize.WriteDiagram(&buf, resp, step, diagramFormat); err != nil {
+			h.respondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		contentType := "text/plain; charset=utf-8"
+		if diagramFormat == serialize.DiagramDot {
+			contentType = "text/vnd.graphviz; charset=utf-8"
+		}
+		h.writeTextResponse(w, buf.Bytes(), contentType)
+		return
+	}
+	narrativeFormat, err := serialize.ParseNarrativeFormat(format)
+	if err != nil {
+		h.respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var buf bytes.Buffer
+	if err := serialize.WriteNarrative(&buf, resp, narrativeFormat); err != nil {
+		h.logger.Error().Err(err).Msg("error rendering narrative")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	contentType := "text/plain; charset=utf-8"
+	if narrativeFormat == serialize.NarrativeMarkdown {
+		contentType = "text/markdown; charset=utf-8"
+	}
+	h.writeTextResponse(w, buf.Bytes(), contentType)
+}
+
+func (h *Handler) writeTextResponse(w http.ResponseWriter, body []byte, contentType string) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(body); err != nil {
+		h.logger.Error().Err(err).Msg("w.Write(body)")
+	}
 }
@@ -57,6 +57,8 @@ func main() {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", h.HandleHealthz)
 	mux.HandleFunc("/GetExecutionSteps", h.HandleGetExecutionSteps)
+	mux.HandleFunc("/QueryExecutionSteps", h.HandleQueryExecutionSteps)
+	mux.HandleFunc("/ExpandVariable", h.HandleExpandVariable)
 	mux.HandleFunc("/compile", h.HandleCompile)
 	mux.HandleFunc("/fmt", h.HandleFmt)
 	mux.HandleFunc("/fix-code", h.HandleFixCode)
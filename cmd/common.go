@@ -6,14 +6,224 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/ahmedakef/gotutor/dlv"
 	"github.com/ahmedakef/gotutor/gateway"
 	"github.com/ahmedakef/gotutor/serialize"
 	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
 )
 
 const _stepsLimit = 1000
 
-func getAndWriteSteps(ctx context.Context, client *gateway.Debug, logger zerolog.Logger) error {
+// addSerializerFlags adds the flags that control what the serializer records to a tracing command
+func addSerializerFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("stats", false, "include line hit counts and function call counts in the steps")
+	cmd.Flags().Bool("call-tree", false, "include the tree of function calls in the steps")
+	cmd.Flags().Bool("collapse-loops", false, "record only the first and last iterations of every loop in full and summarize the rest")
+	cmd.Flags().Int("loop-head", 3, "number of leading loop iterations kept with --collapse-loops")
+	cmd.Flags().Int("loop-tail", 1, "number of trailing loop iterations kept with --collapse-loops")
+	cmd.Flags().Bool("loops-under-limit", false, "don't count the loop iterations past --loop-head against the steps limit, implied by --collapse-loops")
+	cmd.Flags().StringSlice("step-into", nil, "standard library packages whose code is recorded like user code, e.g. sort,strings")
+	cmd.Flags().Int("max-variable-recurse", serialize.DefaultLoadLimits.MaxVariableRecurse, "how deep nested values are loaded")
+	cmd.Flags().Int("max-string-len", serialize.DefaultLoadLimits.MaxStringLen, "maximum number of bytes loaded from strings")
+	cmd.Flags().Int("max-array-values", serialize.DefaultLoadLimits.MaxArrayValues, "maximum number of elements loaded from arrays, slices and maps")
+	cmd.Flags().Int("max-struct-fields", serialize.DefaultLoadLimits.MaxStructFields, "maximum number of fields loaded from structs")
+	cmd.Flags().Bool("scheduler", false, "record the OS threads at every step with the processors (P) they hold and the goroutines they run")
+	cmd.Flags().Bool("disassemble", false, "record the machine code of the functions in main.go and reference the instructions of each step's line")
+	cmd.Flags().Int("mem-stats", 0, "record the heap size, live objects, GC cycles and total allocations every N steps, 0 to disable")
+	cmd.Flags().Bool("slices", false, "record the slice headers of every step, grouped by backing array, and mark the reallocated ones")
+	cmd.Flags().Bool("closures", false, "record the function values held by the variables with the function they run and the variables they captured")
+	cmd.Flags().Bool("truncated", false, "list the variables cut off by the load limits in the steps, to be loaded again with --expand")
+	cmd.Flags().Bool("scopes", false, "record the block declaring every local, whether it is in scope and the variables it shadows")
+	cmd.Flags().Bool("interfaces", false, "record the dynamic type, nil state and implemented methods of the interface values")
+	cmd.Flags().Bool("formatted", false, "show the values of the types with a formatter, built in or declared with //gotutor:format, as a list, a tree or text")
+	cmd.Flags().String("expand", "", "instead of the steps, write the value of this expression at --expand-step to output/steps.json, e.g. the name of a truncated variable")
+	cmd.Flags().Int("expand-step", 0, "index of the step, as recorded before loops are collapsed, where --expand is evaluated")
+	cmd.Flags().Int64("expand-goroutine", 0, "goroutine where --expand is evaluated, 0 for package variables")
+	cmd.Flags().Int("expand-frame", 0, "frame where --expand is evaluated")
+}
+
+// serializerOptions reads the flags added by addSerializerFlags
+func serializerOptions(cmd *cobra.Command) (serialize.Options, error) {
+	var opts serialize.Options
+	var err error
+	opts.Stats, err = cmd.Flags().GetBool("stats")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get stats flag: %w", err)
+	}
+	opts.CallTree, err = cmd.Flags().GetBool("call-tree")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get call-tree flag: %w", err)
+	}
+	opts.CollapseLoops, err = cmd.Flags().GetBool("collapse-loops")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get collapse-loops flag: %w", err)
+	}
+	opts.LoopHead, err = cmd.Flags().GetInt("loop-head")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get loop-head flag: %w", err)
+	}
+	opts.LoopTail, err = cmd.Flags().GetInt("loop-tail")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get loop-tail flag: %w", err)
+	}
+	opts.LoopsUnderLimit, err = cmd.Flags().GetBool("loops-under-limit")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get loops-under-limit flag: %w", err)
+	}
+	opts.StepInto, err = cmd.Flags().GetStringSlice("step-into")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get step-into flag: %w", err)
+	}
+	opts.Load.MaxVariableRecurse, err = cmd.Flags().GetInt("max-variable-recurse")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get max-variable-recurse flag: %w", err)
+	}
+	opts.Load.MaxStringLen, err = cmd.Flags().GetInt("max-string-len")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get max-string-len flag: %w", err)
+	}
+	opts.Load.MaxArrayValues, err = cmd.Flags().GetInt("max-array-values")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get max-array-values flag: %w", err)
+	}
+	opts.Load.MaxStructFields, err = cmd.Flags().GetInt("max-struct-fields")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get max-struct-fields flag: %w", err)
+	}
+	opts.Scheduler, err = cmd.Flags().GetBool("scheduler")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get scheduler flag: %w", err)
+	}
+	opts.Disassemble, err = cmd.Flags().GetBool("disassemble")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get disassemble flag: %w", err)
+	}
+	opts.MemStats, err = cmd.Flags().GetInt("mem-stats")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get mem-stats flag: %w", err)
+	}
+	opts.Slices, err = cmd.Flags().GetBool("slices")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get slices flag: %w", err)
+	}
+	opts.Closures, err = cmd.Flags().GetBool("closures")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get closures flag: %w", err)
+	}
+	opts.Truncated, err = cmd.Flags().GetBool("truncated")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get truncated flag: %w", err)
+	}
+	opts.Scopes, err = cmd.Flags().GetBool("scopes")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get scopes flag: %w", err)
+	}
+	opts.Interfaces, err = cmd.Flags().GetBool("interfaces")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get interfaces flag: %w", err)
+	}
+	opts.Formatted, err = cmd.Flags().GetBool("formatted")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get formatted flag: %w", err)
+	}
+	expression, err := cmd.Flags().GetString("expand")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get expand flag: %w", err)
+	}
+	if expression == "" {
+		return opts, nil
+	}
+	expand := serialize.ExpandRequest{Expression: expression}
+	expand.Step, err = cmd.Flags().GetInt("expand-step")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get expand-step flag: %w", err)
+	}
+	expand.Goroutine, err = cmd.Flags().GetInt64("expand-goroutine")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get expand-goroutine flag: %w", err)
+	}
+	expand.Frame, err = cmd.Flags().GetInt("expand-frame")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get expand-frame flag: %w", err)
+	}
+	opts.Expand = &expand
+	return opts, nil
+}
+
+// addBuildFlags adds the flags that control how the traced program is built
+func addBuildFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("race", false, "build the program with the race detector and attach data race reports to the steps")
+	cmd.Flags().Bool("faketime", false, "build the program with -tags=faketime: its clock only moves when all goroutines sleep, without waiting, and every step records it")
+	cmd.Flags().Bool("gc-diagnostics", false, "attach the escape analysis and inlining decisions of the compiler (-gcflags=-m) to the steps of their lines")
+}
+
+// buildOptions reads the flags added by addBuildFlags
+func buildOptions(cmd *cobra.Command) (dlv.BuildOptions, error) {
+	var opts dlv.BuildOptions
+	var err error
+	opts.Race, err = cmd.Flags().GetBool("race")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get race flag: %w", err)
+	}
+	opts.Faketime, err = cmd.Flags().GetBool("faketime")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get faketime flag: %w", err)
+	}
+	opts.Diagnostics, err = cmd.Flags().GetBool("gc-diagnostics")
+	if err != nil {
+		return opts, fmt.Errorf("failed to get gc-diagnostics flag: %w", err)
+	}
+	return opts, nil
+}
+
+// addLaunchFlags adds the flags that control the environment the traced program is started in
+func addLaunchFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("gomaxprocs", 0, "GOMAXPROCS of the traced program, 0 keeps the runtime's default")
+	cmd.Flags().Bool("deterministic", false, "record the same steps on every run: GOMAXPROCS=1, a fixed random seed, no address randomization and faketime when the program is built")
+}
+
+// launchOptions reads the flags added by addLaunchFlags, deterministic runs also fix the random seed of the runtime
+func launchOptions(cmd *cobra.Command, opts *serialize.Options) (dlv.LaunchOptions, error) {
+	var launch dlv.LaunchOptions
+	var err error
+	launch.GOMAXPROCS, err = cmd.Flags().GetInt("gomaxprocs")
+	if err != nil {
+		return launch, fmt.Errorf("failed to get gomaxprocs flag: %w", err)
+	}
+	launch.Deterministic, err = cmd.Flags().GetBool("deterministic")
+	if err != nil {
+		return launch, fmt.Errorf("failed to get deterministic flag: %w", err)
+	}
+	opts.Deterministic = launch.Deterministic
+	return launch, nil
+}
+
+// addCompilerDiagnostics compiles the program with -gcflags=-m when asked to and adds its diagnostics to the options
+func addCompilerDiagnostics(sourcePath string, buildOpts dlv.BuildOptions, opts *serialize.Options) error {
+	if !buildOpts.Diagnostics {
+		return nil
+	}
+	out, err := dlv.CompilerDiagnostics(sourcePath)
+	if err != nil {
+		return fmt.Errorf("compiler diagnostics: %w", err)
+	}
+	opts.Diagnostics = serialize.ParseCompilerDiagnostics(out)
+	return nil
+}
+
+func getAndWriteSteps(ctx context.Context, client *gateway.Debug, logger zerolog.Logger, opts serialize.Options) error {
+	if opts.Expand != nil {
+		return expandAndWriteVariable(ctx, client, logger, opts)
+	}
+	steps, err := getSteps(ctx, client, logger, opts)
+	if err != nil {
+		return err
+	}
+	return writeSteps(steps, logger)
+}
+
+func getSteps(ctx context.Context, client *gateway.Debug, logger zerolog.Logger, opts serialize.Options) (serialize.ExecutionResponse, error) {
 
 	defer func() {
 		logger.Debug().Msg("killing the debugger")
@@ -23,13 +233,41 @@ func getAndWriteSteps(ctx context.Context, client *gateway.Debug, logger zerolog
 		}
 	}()
 
-	serializer := serialize.NewSerializer(client, logger)
+	serializer := serialize.NewSerializer(client, logger, opts)
 	steps, err := serializer.ExecutionSteps(ctx, _stepsLimit)
 	if err != nil {
-		return fmt.Errorf("failed to get execution steps: %w", err)
+		return steps, fmt.Errorf("failed to get execution steps: %w", err)
+	}
+	return steps, nil
+}
+
+// expandAndWriteVariable writes the variable asked for by opts.Expand in place of the steps,
+// so that it's returned by the callers reading output/steps.json
+func expandAndWriteVariable(ctx context.Context, client *gateway.Debug, logger zerolog.Logger, opts serialize.Options) error {
+	defer func() {
+		logger.Debug().Msg("killing the debugger")
+		err := client.Detach(true)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to halt the execution")
+		}
+	}()
+
+	serializer := serialize.NewSerializer(client, logger, opts)
+	variable, err := serializer.ExpandVariable(ctx, _stepsLimit, *opts.Expand)
+	if err != nil {
+		return fmt.Errorf("failed to expand variable: %w", err)
 	}
+	return writeOutput(variable, logger)
+}
+
+func writeSteps(steps serialize.ExecutionResponse, logger zerolog.Logger) error {
+	return writeOutput(steps, logger)
+}
+
+// writeOutput writes the value as json to output/steps.json
+func writeOutput(value any, logger zerolog.Logger) error {
 	// make sure the output directory exists
-	err = os.MkdirAll("output", 0755)
+	err := os.MkdirAll("output", 0755)
 	if err != nil {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
@@ -44,7 +282,7 @@ func getAndWriteSteps(ctx context.Context, client *gateway.Debug, logger zerolog
 		}
 	}()
 
-	err = json.NewEncoder(file).Encode(steps)
+	err = json.NewEncoder(file).Encode(value)
 	if err != nil {
 		return fmt.Errorf("failed to encode steps: %w", err)
 	}
@@ -55,3 +293,19 @@ func getAndWriteSteps(ctx context.Context, client *gateway.Debug, logger zerolog
 	}
 	return nil
 }
+
+// readSteps reads execution steps previously written by writeSteps
+func readSteps(path string) (serialize.ExecutionResponse, error) {
+	var steps serialize.ExecutionResponse
+	file, err := os.Open(path)
+	if err != nil {
+		return steps, fmt.Errorf("failed to open steps file: %w", err)
+	}
+	defer file.Close()
+
+	err = json.NewDecoder(file).Decode(&steps)
+	if err != nil {
+		return steps, fmt.Errorf("failed to decode steps: %w", err)
+	}
+	return steps, nil
+}
@@ -24,6 +24,10 @@ func connect(cmd *cobra.Command, args []string) error {
 	ctx, cancel := context.WithCancel(cmd.Context())
 	defer cancel()
 	logger := ctx.Value(loggerKey).(zerolog.Logger)
+	opts, err := serializerOptions(cmd)
+	if err != nil {
+		return err
+	}
 
 	addr, err := cmd.Flags().GetString("address")
 	if err != nil {
@@ -36,7 +40,7 @@ func connect(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	err = getAndWriteSteps(ctx, client, logger)
+	err = getAndWriteSteps(ctx, client, logger, opts)
 	if err != nil {
 		logger.Error().Err(err).Msg("getAndWriteSteps")
 		return nil
@@ -46,5 +50,6 @@ func connect(cmd *cobra.Command, args []string) error {
 
 func init() {
 	connectCmd.Flags().String("address", ":8083", "address of the server to connect to")
+	addSerializerFlags(connectCmd)
 	rootCmd.AddCommand(connectCmd)
 }
@@ -34,24 +34,42 @@ func debug(cmd *cobra.Command, args []string) error {
 	ctx, cancel := context.WithCancel(cmd.Context())
 	defer cancel()
 	logger := ctx.Value(loggerKey).(zerolog.Logger)
+	opts, err := serializerOptions(cmd)
+	if err != nil {
+		return err
+	}
+	buildOpts, err := buildOptions(cmd)
+	if err != nil {
+		return err
+	}
+	launch, err := launchOptions(cmd, &opts)
+	if err != nil {
+		return err
+	}
+	buildOpts.Faketime = buildOpts.Faketime || launch.Deterministic
 
 	sourcePath := ""
 	if len(args) == 1 {
 		sourcePath = args[0]
 	}
-	binaryPath, err := dlv.Build(sourcePath, "")
+	binaryPath, err := dlv.Build(sourcePath, "", buildOpts)
 	if err != nil {
 		logger.Error().Err(err).Msg("failed to build binary")
 		return nil
 	}
 	defer gobuild.Remove(binaryPath)
+	err = addCompilerDiagnostics(sourcePath, buildOpts, &opts)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to get compiler diagnostics")
+		return nil
+	}
 
-	client, err := dlv.RunServerAndGetClient(binaryPath, sourcePath, dlv.GetBuildFlags(), debugger.ExecutingGeneratedFile)
+	client, err := dlv.RunServerAndGetClient(binaryPath, sourcePath, buildOpts.Flags(), debugger.ExecutingGeneratedFile, launch)
 	if err != nil {
 		return fmt.Errorf("runServerAndGetClient: %w", err)
 	}
 
-	err = getAndWriteSteps(ctx, client, logger)
+	err = getAndWriteSteps(ctx, client, logger, opts)
 	if err != nil {
 		logger.Error().Err(err).Msg("getAndWriteSteps")
 		return nil
@@ -61,6 +79,9 @@ func debug(cmd *cobra.Command, args []string) error {
 }
 
 func init() {
+	addSerializerFlags(debugCmd)
+	addBuildFlags(debugCmd)
+	addLaunchFlags(debugCmd)
 	rootCmd.AddCommand(debugCmd)
 
 }
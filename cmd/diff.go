@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ahmedakef/gotutor/serialize"
+	"github.com/spf13/cobra"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff a.json b.json",
+	Short: "Compare the execution steps of two runs of the same or similar programs.",
+	Long: `Align two recorded traces by source location and call structure and report
+the first step where the execution diverges, the variables whose values differ
+at aligned steps and the differences in the program output.`,
+	RunE: diff,
+	Args: cobra.ExactArgs(2),
+}
+
+func diff(cmd *cobra.Command, args []string) error {
+	asJSON, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return fmt.Errorf("failed to get json flag: %w", err)
+	}
+	a, err := readSteps(args[0])
+	if err != nil {
+		return err
+	}
+	b, err := readSteps(args[1])
+	if err != nil {
+		return err
+	}
+
+	traceDiff := serialize.DiffTraces(a, b)
+	if asJSON {
+		return json.NewEncoder(os.Stdout).Encode(traceDiff)
+	}
+	return writeTraceDiff(os.Stdout, traceDiff)
+}
+
+func writeTraceDiff(w io.Writer, traceDiff serialize.TraceDiff) error {
+	var err error
+	printf := func(format string, args ...any) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+	printf("%d aligned steps\n", len(traceDiff.Aligned))
+	if divergence := traceDiff.FirstDivergence; divergence != nil {
+		printf("execution diverges at step %d (%s) vs step %d (%s)\n",
+			divergence.StepA, divergence.LocationA, divergence.StepB, divergence.LocationB)
+	} else {
+		printf("execution follows the same path\n")
+	}
+	for _, valueDiff := range traceDiff.ValueDiffs {
+		printf("%s.%s differs first at step %d vs step %d: %s vs %s (%d aligned steps)\n",
+			valueDiff.Function, valueDiff.Variable, valueDiff.StepA, valueDiff.StepB,
+			valueDiff.ValueA, valueDiff.ValueB, valueDiff.Occurrences)
+	}
+	for _, outputDiff := range traceDiff.OutputDiffs {
+		printf("%s differs at line %d: %q vs %q\n", outputDiff.Stream, outputDiff.Line, outputDiff.A, outputDiff.B)
+	}
+	return err
+}
+
+func init() {
+	diffCmd.Flags().Bool("json", false, "print the diff as JSON")
+	rootCmd.AddCommand(diffCmd)
+}
@@ -33,15 +33,24 @@ func execute(cmd *cobra.Command, args []string) error {
 	ctx, cancel := context.WithCancel(cmd.Context())
 	defer cancel()
 	logger := ctx.Value(loggerKey).(zerolog.Logger)
+	opts, err := serializerOptions(cmd)
+	if err != nil {
+		return err
+	}
+
+	launch, err := launchOptions(cmd, &opts)
+	if err != nil {
+		return err
+	}
 
 	binaryPath := args[0]
-	client, err := dlv.RunServerAndGetClient(binaryPath, "", dlv.GetBuildFlags(), debugger.ExecutingExistingFile)
+	client, err := dlv.RunServerAndGetClient(binaryPath, "", dlv.GetBuildFlags(), debugger.ExecutingExistingFile, launch)
 	if err != nil {
 		logger.Error().Err(err).Msg("runServerAndGetClient")
 		return nil
 	}
 
-	err = getAndWriteSteps(ctx, client, logger)
+	err = getAndWriteSteps(ctx, client, logger, opts)
 	if err != nil {
 		logger.Error().Err(err).Msg("getAndWriteSteps")
 		return nil
@@ -51,6 +60,8 @@ func execute(cmd *cobra.Command, args []string) error {
 }
 
 func init() {
+	addSerializerFlags(execCmd)
+	addLaunchFlags(execCmd)
 	rootCmd.AddCommand(execCmd)
 
 }
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/ahmedakef/gotutor/dlv"
+	"github.com/ahmedakef/gotutor/serialize"
+	"github.com/go-delve/delve/pkg/gobuild"
+	"github.com/go-delve/delve/service/debugger"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+)
+
+// runCmd represents the run command
+var runCmd = &cobra.Command{
+	Use:   "run [source]",
+	Short: "Compile and trace the program, then print the execution steps in the chosen format.",
+	Long: `Compiles the program the same way as debug does, records its execution steps
+and prints them in the chosen format.
+
+The json format writes the steps to output/steps.json, while text and markdown
+print a step by step narrative of the execution to stdout, suitable for written tutorials.`,
+	RunE: run,
+	Args: cobra.RangeArgs(0, 1),
+}
+
+func run(cmd *cobra.Command, args []string) error {
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+	logger := ctx.Value(loggerKey).(zerolog.Logger)
+	opts, err := serializerOptions(cmd)
+	if err != nil {
+		return err
+	}
+	buildOpts, err := buildOptions(cmd)
+	if err != nil {
+		return err
+	}
+	launch, err := launchOptions(cmd, &opts)
+	if err != nil {
+		return err
+	}
+	buildOpts.Faketime = buildOpts.Faketime || launch.Deterministic
+
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return fmt.Errorf("failed to get format flag: %w", err)
+	}
+	var narrativeFormat serialize.NarrativeFormat
+	if format != "json" {
+		narrativeFormat, err = serialize.ParseNarrativeFormat(format)
+		if err != nil {
+			return err
+		}
+	}
+
+	sourcePath := ""
+	if len(args) == 1 {
+		sourcePath = args[0]
+	}
+	binaryPath, err := dlv.Build(sourcePath, "", buildOpts)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to build binary")
+		return nil
+	}
+	defer gobuild.Remove(binaryPath)
+	err = addCompilerDiagnostics(sourcePath, buildOpts, &opts)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to get compiler diagnostics")
+		return nil
+	}
+
+	client, err := dlv.RunServerAndGetClient(binaryPath, sourcePath, buildOpts.Flags(), debugger.ExecutingGeneratedFile, launch)
+	if err != nil {
+		return fmt.Errorf("runServerAndGetClient: %w", err)
+	}
+
+	if opts.Expand != nil {
+		err = expandAndWriteVariable(ctx, client, logger, opts)
+		if err != nil {
+			logger.Error().Err(err).Msg("expandAndWriteVariable")
+		}
+		return nil
+	}
+	steps, err := getSteps(ctx, client, logger, opts)
+	if err != nil {
+		logger.Error().Err(err).Msg("getSteps")
+		return nil
+	}
+	if format == "json" {
+		err = writeSteps(steps, logger)
+	} else {
+		err = serialize.WriteNarrative(os.Stdout, steps, narrativeFormat)
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to write steps")
+	}
+	return nil
+}
+
+func init() {
+	runCmd.Flags().String("format", "json", "output format: json, text or markdown")
+	addSerializerFlags(runCmd)
+	addBuildFlags(runCmd)
+	addLaunchFlags(runCmd)
+	rootCmd.AddCommand(runCmd)
+}
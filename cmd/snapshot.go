@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ahmedakef/gotutor/serialize"
+	"github.com/spf13/cobra"
+)
+
+// snapshotCmd represents the snapshot command
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot steps.json",
+	Short: "Render the memory state at a step as a Graphviz or Mermaid diagram.",
+	Long: `Render the stack frames, package variables and the heap objects reachable from them
+at the given step of a recorded trace as a diagram with an edge for every pointer.
+
+The diagram is printed to stdout, pipe it to "dot -Tsvg" or paste it in a mermaid block.`,
+	RunE: snapshot,
+	Args: cobra.ExactArgs(1),
+}
+
+func snapshot(cmd *cobra.Command, args []string) error {
+	step, err := cmd.Flags().GetInt("step")
+	if err != nil {
+		return fmt.Errorf("failed to get step flag: %w", err)
+	}
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return fmt.Errorf("failed to get format flag: %w", err)
+	}
+	diagramFormat, err := serialize.ParseDiagramFormat(format)
+	if err != nil {
+		return err
+	}
+
+	steps, err := readSteps(args[0])
+	if err != nil {
+		return err
+	}
+	return serialize.WriteDiagram(os.Stdout, steps, step, diagramFormat)
+}
+
+func init() {
+	snapshotCmd.Flags().Int("step", 0, "index of the step to render, starting from 0")
+	snapshotCmd.Flags().String("format", "dot", "diagram format: dot or mermaid")
+	rootCmd.AddCommand(snapshotCmd)
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ahmedakef/gotutor/serialize"
+	"github.com/spf13/cobra"
+)
+
+// _heatmapWidth is the width of the bar drawn for the most executed line
+const _heatmapWidth = 40
+
+// statsCmd represents the stats command
+var statsCmd = &cobra.Command{
+	Use:   "stats steps.json",
+	Short: "Print line hit counts and function call counts of a recorded trace.",
+	Long: `Print how many steps were recorded at each line, as a heatmap, and how many times
+each function was called in a recorded trace.
+
+Comparing the hit counts of runs with different input sizes shows the algorithmic
+complexity of the program empirically.`,
+	RunE: stats,
+	Args: cobra.ExactArgs(1),
+}
+
+func stats(cmd *cobra.Command, args []string) error {
+	steps, err := readSteps(args[0])
+	if err != nil {
+		return err
+	}
+	executionStats := serialize.ComputeStats(steps.Steps)
+	return writeStats(os.Stdout, executionStats)
+}
+
+func writeStats(w io.Writer, executionStats serialize.ExecutionStats) error {
+	var b strings.Builder
+	for _, file := range slices.Sorted(maps.Keys(executionStats.LineHits)) {
+		hits := executionStats.LineHits[file]
+		maxHits := slices.Max(slices.Collect(maps.Values(hits)))
+		fmt.Fprintf(&b, "%s\n", file)
+		for _, line := range slices.Sorted(maps.Keys(hits)) {
+			bar := strings.Repeat("#", max(1, hits[line]*_heatmapWidth/maxHits))
+			fmt.Fprintf(&b, "  line %4d %6d %s\n", line, hits[line], bar)
+		}
+	}
+	b.WriteString("function calls\n")
+	functions := slices.Sorted(maps.Keys(executionStats.FunctionCalls))
+	for _, function := range functions {
+		fmt.Fprintf(&b, "  %-30s %6d\n", function, executionStats.FunctionCalls[function])
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+}
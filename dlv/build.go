@@ -2,35 +2,88 @@ package dlv
 
 import (
 	"fmt"
+	"os"
+	"os/exec"
 	"runtime"
+	"strings"
 
+	"github.com/go-delve/delve/pkg/config"
 	"github.com/go-delve/delve/pkg/gobuild"
 	"github.com/go-delve/delve/pkg/goversion"
 )
 
+// BuildOptions controls how the debugged binary is built
+type BuildOptions struct {
+	// Race builds the binary with the race detector enabled, it requires cgo
+	Race bool
+	// Faketime builds the binary with -tags=faketime, the clock of the program only moves when it sleeps
+	// and its writes to stdout and stderr are prefixed with playback headers
+	Faketime bool
+	// Diagnostics also compiles the program with -gcflags=-m to get the escape analysis and inlining decisions,
+	// see CompilerDiagnostics
+	Diagnostics bool
+}
+
+// Flags returns the build flags for the given options on top of the default ones
+func (o BuildOptions) Flags() string {
+	buildFlags := GetBuildFlags()
+	if o.Race {
+		buildFlags = strings.TrimSpace(buildFlags + " -race")
+	}
+	if o.Faketime {
+		buildFlags = strings.TrimSpace(buildFlags + " -tags=faketime")
+	}
+	return buildFlags
+}
+
 // Build builds the binary in temporary directory and return the path to the binary given a sourcePath
-func Build(sourcePath string, outputPrefix string) (string, error) {
+func Build(sourcePath string, outputPrefix string, opts BuildOptions) (string, error) {
 	args := []string{sourcePath}
-	debugName, err := buildBinary(args, outputPrefix, false)
+	var env []string
+	if opts.Race {
+		// the race detector runtime is linked through cgo
+		env = append(os.Environ(), "CGO_ENABLED=1")
+	}
+	debugName, err := buildBinary(args, outputPrefix, opts.Flags(), false, env)
 	return debugName, err
 }
 
-func buildBinary(args []string, outputPrefix string, isTest bool) (string, error) {
-	buildFlags := GetBuildFlags()
+// CompilerDiagnostics compiles the program at sourcePath with optimizations and -gcflags=-m and returns the
+// escape analysis and inlining decisions the compiler printed. It's a separate build as the debugged binary
+// is built with optimizations and inlining disabled, which changes the decisions.
+func CompilerDiagnostics(sourcePath string) (string, error) {
+	if sourcePath == "" {
+		sourcePath = "."
+	}
+	cmd := exec.Command("go", "build", "-gcflags=-m", "-o", os.DevNull, sourcePath)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s%w", string(out), err)
+	}
+	return string(out), nil
+}
+
+// buildBinary builds the binary like delve's gobuild does, with optimizations and inlining disabled,
+// the go command runs with env, or the environment of the process when it's nil
+func buildBinary(args []string, outputPrefix string, buildFlags string, isTest bool, env []string) (string, error) {
 	var debugName string
-	var err error
+	command := "build"
 	if isTest {
 		debugName = gobuild.DefaultDebugBinaryPath(outputPrefix + "debug.test")
+		command = "test"
 	} else {
 		debugName = gobuild.DefaultDebugBinaryPath(outputPrefix + "__debug_bin")
 	}
 
-	var out []byte
+	goArgs := []string{command, "-o", debugName}
 	if isTest {
-		_, out, err = gobuild.GoTestBuildCombinedOutput(debugName, args, buildFlags)
-	} else {
-		_, out, err = gobuild.GoBuildCombinedOutput(debugName, args, buildFlags)
+		goArgs = append(goArgs, "-c")
 	}
+	goArgs = append(goArgs, "-gcflags", "all=-N -l")
+	goArgs = append(goArgs, config.SplitQuotedFields(buildFlags, '\'')...)
+	cmd := exec.Command("go", append(goArgs, args...)...)
+	cmd.Env = env
+	out, err := cmd.CombinedOutput()
 	if err != nil {
 		err = fmt.Errorf("%v%w", string(out), err)
 	}
@@ -47,6 +100,6 @@ func GetBuildFlags() string {
 			buildFlagsDefault = "-ldflags='-linkmode internal'"
 		}
 	}
-	//buildFlagsDefault += " -gcflags='all=-N -l'" // Disable optimizations and inlining, probably already added in goBuildArgs2 in github.com/go-delve/delve@v1.24.0/pkg/gobuild/gobuild.go
+	//buildFlagsDefault += " -gcflags='all=-N -l'" // Disable optimizations and inlining, already added by buildBinary
 	return buildFlagsDefault
 }
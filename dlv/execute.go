@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
 
 	"github.com/ahmedakef/gotutor/gateway"
 	"github.com/go-delve/delve/pkg/proc"
@@ -13,7 +14,15 @@ import (
 	"github.com/go-delve/delve/service/rpccommon"
 )
 
-func RunServerAndGetClient(debugName string, target string, buildFlags string, kind debugger.ExecuteKind) (*gateway.Debug, error) {
+// LaunchOptions controls the environment the debugged program is started in
+type LaunchOptions struct {
+	// GOMAXPROCS of the program, 0 keeps the runtime's default
+	GOMAXPROCS int
+	// Deterministic runs the program with GOMAXPROCS=1 and without address space randomization
+	Deterministic bool
+}
+
+func RunServerAndGetClient(debugName string, target string, buildFlags string, kind debugger.ExecuteKind, launch LaunchOptions) (*gateway.Debug, error) {
 	listener, clientConn := service.ListenerPipe()
 	defer func() {
 		if err := listener.Close(); err != nil {
@@ -53,7 +62,7 @@ func RunServerAndGetClient(debugName string, target string, buildFlags string, k
 			Stdin:                 "",
 			Stdout:                proc.OutputRedirect{Path: "output/stdout.log"},
 			Stderr:                proc.OutputRedirect{Path: "output/stderr.log"},
-			DisableASLR:           false,
+			DisableASLR:           launch.Deterministic,
 			RrOnProcessPid:        0,
 			AttachWaitFor:         "",
 			AttachWaitForInterval: 1,
@@ -61,7 +70,7 @@ func RunServerAndGetClient(debugName string, target string, buildFlags string, k
 		},
 	})
 
-	if err := server.Run(); err != nil {
+	if err := launch.run(server.Run); err != nil {
 		if errors.Is(err, api.ErrNotExecutable) {
 			switch kind {
 			case debugger.ExecutingGeneratedFile:
@@ -79,6 +88,31 @@ func RunServerAndGetClient(debugName string, target string, buildFlags string, k
 
 }
 
+// run launches the program with the given function, with GOMAXPROCS set in its environment when asked for.
+// delve starts the program with the environment of the server and has no option for its own, so it's only
+// set in the environment of gotutor until the program is launched.
+func (o LaunchOptions) run(launch func() error) error {
+	gomaxprocs := o.GOMAXPROCS
+	if o.Deterministic {
+		gomaxprocs = 1
+	}
+	if gomaxprocs == 0 {
+		return launch()
+	}
+	previous, ok := os.LookupEnv("GOMAXPROCS")
+	if err := os.Setenv("GOMAXPROCS", strconv.Itoa(gomaxprocs)); err != nil {
+		return fmt.Errorf("set GOMAXPROCS: %w", err)
+	}
+	defer func() {
+		if ok {
+			_ = os.Setenv("GOMAXPROCS", previous)
+		} else {
+			_ = os.Unsetenv("GOMAXPROCS")
+		}
+	}()
+	return launch()
+}
+
 func truncateFile(path string) error {
 	// Create creates or truncates the named file. If the file already exists
 	file, err := os.Create(path)
@@ -57,6 +57,32 @@ func (d *Debug) ListPackageVariables(ctx context.Context, filter string, cfg api
 	return d.client.ListPackageVariables(filter, cfg)
 }
 
+func (d *Debug) EvalVariable(ctx context.Context, scope api.EvalScope, expr string, cfg api.LoadConfig) (*api.Variable, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	d.getToken()
+	defer d.releaseToken()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return d.client.EvalVariable(scope, expr, cfg)
+}
+
+func (d *Debug) SetVariable(ctx context.Context, scope api.EvalScope, symbol, value string) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	d.getToken()
+	defer d.releaseToken()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return d.client.SetVariable(scope, symbol, value)
+}
+
 func (d *Debug) CreateBreakpoint(ctx context.Context, breakPoint *api.Breakpoint) (*api.Breakpoint, error) {
 	if ctx.Err() != nil {
 		return nil, ctx.Err()
@@ -70,6 +96,46 @@ func (d *Debug) CreateBreakpoint(ctx context.Context, breakPoint *api.Breakpoint
 	return d.client.CreateBreakpoint(breakPoint)
 }
 
+func (d *Debug) FunctionReturnLocations(ctx context.Context, fnName string) ([]uint64, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	d.getToken()
+	defer d.releaseToken()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return d.client.FunctionReturnLocations(fnName)
+}
+
+func (d *Debug) ListBreakpoints(ctx context.Context) ([]*api.Breakpoint, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	d.getToken()
+	defer d.releaseToken()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return d.client.ListBreakpoints(false)
+}
+
+func (d *Debug) FindLocation(ctx context.Context, scope api.EvalScope, loc string) ([]api.Location, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	d.getToken()
+	defer d.releaseToken()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	locations, _, err := d.client.FindLocation(scope, loc, false, nil)
+	return locations, err
+}
+
 func (d *Debug) ClearBreakpointByName(ctx context.Context, name string) (*api.Breakpoint, error) {
 	if ctx.Err() != nil {
 		return nil, ctx.Err()
@@ -192,6 +258,36 @@ func (d *Debug) TraceDirectory(ctx context.Context) (string, error) {
 	return d.client.TraceDirectory()
 }
 
+func (d *Debug) ListThreads(ctx context.Context) ([]*api.Thread, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	d.getToken()
+	defer d.releaseToken()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return d.client.ListThreads()
+}
+
+// Disassemble disassembles the code between startPC and endPC, or the whole function containing startPC when endPC is 0
+func (d *Debug) Disassemble(ctx context.Context, scope api.EvalScope, startPC, endPC uint64, flavour api.AssemblyFlavour) (api.AsmInstructions, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	d.getToken()
+	defer d.releaseToken()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if endPC == 0 {
+		return d.client.DisassemblePC(scope, startPC, flavour)
+	}
+	return d.client.DisassembleRange(scope, startPC, endPC, flavour)
+}
+
 func (d *Debug) Halt(ctx context.Context) (*api.DebuggerState, error) {
 	if ctx.Err() != nil {
 		return nil, ctx.Err()
@@ -205,6 +301,14 @@ func (d *Debug) Halt(ctx context.Context) (*api.DebuggerState, error) {
 	return d.client.Halt()
 }
 
+// SetReturnValuesLoadConfig sets the load config used for the return values of the functions stepped out of
+func (d *Debug) SetReturnValuesLoadConfig(cfg *api.LoadConfig) {
+	d.getToken()
+	defer d.releaseToken()
+
+	d.client.SetReturnValuesLoadConfig(cfg)
+}
+
 func (d *Debug) Detach(kill bool) error {
 	d.getToken()
 	defer d.releaseToken()
@@ -0,0 +1,129 @@
+package serialize
+
+import "github.com/go-delve/delve/service/api"
+
+// CallNode is a single function call in the call tree of a goroutine
+type CallNode struct {
+	Function  string         `json:"function"`
+	Goroutine int64          `json:"goroutine"`
+	Args      []api.Variable `json:"args"`
+	// ReturnValues is empty when the call didn't return before the trace ended
+	ReturnValues []api.Variable `json:"returnValues,omitempty"`
+	// FirstStep and LastStep are the indexes of the first and last steps recorded while the call was on the stack,
+	// see CollapseLoops for where they point once the loops are collapsed
+	FirstStep int         `json:"firstStep"`
+	LastStep  int         `json:"lastStep"`
+	Children  []*CallNode `json:"children,omitempty"`
+}
+
+// BuildCallTree builds the tree of calls made in main.go from the recorded steps,
+// it returns one root per goroutine in the order the goroutines were first seen
+func BuildCallTree(steps []Step) []*CallNode {
+	var roots []*CallNode
+	tracker := newCallTracker()
+	// open holds the calls currently on the stack of each goroutine, from the outermost to the innermost
+	open := map[int64][]*CallNode{}
+	for i := range steps {
+		data := &steps[i].GoroutinesData[0]
+		goroutine := data.Goroutine.ID
+		stack, previous, firstCall := tracker.advance(data)
+
+		calls := open[goroutine]
+		if returned := calls[min(firstCall, len(calls)):]; len(returned) > 0 && len(previous) > 0 {
+			// the return values belong to the innermost call that just returned
+			returned[len(returned)-1].ReturnValues = steps[i].ReturnValues
+		}
+		calls = calls[:min(firstCall, len(calls))]
+		for _, frame := range stack[firstCall:] {
+			node := &CallNode{
+				Function:  frame.function,
+				Goroutine: goroutine,
+				Args:      callArguments(data.Stacktrace[frame.index].Arguments),
+				FirstStep: i,
+			}
+			if len(calls) == 0 {
+				roots = append(roots, node)
+			} else {
+				parent := calls[len(calls)-1]
+				parent.Children = append(parent.Children, node)
+			}
+			calls = append(calls, node)
+		}
+		for _, node := range calls {
+			node.LastStep = i
+		}
+		open[goroutine] = calls
+	}
+	return roots
+}
+
+// callArguments drops the return values that delve lists along with the arguments
+func callArguments(args []api.Variable) []api.Variable {
+	var filtered []api.Variable
+	for _, arg := range args {
+		if arg.Flags&api.VariableReturnArgument == 0 {
+			filtered = append(filtered, arg)
+		}
+	}
+	return filtered
+}
+
+// userFrame is the part of a stack frame used to tell calls apart
+type userFrame struct {
+	function string
+	line     int
+	// index is the position of the frame in the goroutine stacktrace
+	index int
+}
+
+// callTracker follows the frames in main.go of every goroutine across steps to tell when functions are called
+type callTracker struct {
+	// entryLines holds the first line each function was seen at, which is where stepping into it stops
+	entryLines map[string]int
+	stacks     map[int64][]userFrame
+}
+
+func newCallTracker() *callTracker {
+	return &callTracker{
+		entryLines: map[string]int{},
+		stacks:     map[int64][]userFrame{},
+	}
+}
+
+// advance records the stack of the goroutine and returns it along with the stack it had in its previous step,
+// frames of the current stack from firstCall up are new calls and frames of the previous stack from firstCall up returned
+func (t *callTracker) advance(data *GoRoutineData) (stack []userFrame, previous []userFrame, firstCall int) {
+	stack = userFrames(data.Stacktrace)
+	previous = t.stacks[data.Goroutine.ID]
+	t.stacks[data.Goroutine.ID] = stack
+	for depth, frame := range stack {
+		if _, ok := t.entryLines[frame.function]; !ok {
+			t.entryLines[frame.function] = frame.line
+		}
+		if depth >= len(previous) || t.isNewCall(previous[depth], frame, depth == len(stack)-1) {
+			return stack, previous, depth
+		}
+	}
+	return stack, previous, len(stack)
+}
+
+// isNewCall reports whether frame is a different call than previous, which was at the same depth in the last step.
+// A function calling itself again at the same depth looks the same, so returning to the entry line of the top frame
+// is treated as a new call.
+func (t *callTracker) isNewCall(previous, frame userFrame, top bool) bool {
+	if previous.function != frame.function {
+		return true
+	}
+	return top && frame.line == t.entryLines[frame.function] && previous.line != frame.line
+}
+
+// userFrames returns the frames in main.go ordered from the outermost call to the innermost
+func userFrames(stacktrace []api.Stackframe) []userFrame {
+	var frames []userFrame
+	for i := len(stacktrace) - 1; i >= 0; i-- {
+		if isInMainDotGo(stacktrace[i].File) {
+			frames = append(frames, userFrame{function: stacktrace[i].Function.Name(), line: stacktrace[i].Line, index: i})
+		}
+	}
+	return frames
+}
@@ -0,0 +1,73 @@
+package serialize
+
+import (
+	"testing"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// newStackStep builds a step of goroutine 1 whose stack holds the given frames, innermost first
+func newStackStep(frames ...api.Stackframe) Step {
+	return Step{
+		GoroutinesData: []GoRoutineData{{
+			Goroutine:  &api.Goroutine{ID: 1, CurrentLoc: frames[0].Location},
+			Stacktrace: frames,
+		}},
+	}
+}
+
+func frameAt(function string, line int, args ...api.Variable) api.Stackframe {
+	return api.Stackframe{
+		Location:  api.Location{File: "/tmp/main.go", Line: line, Function: &api.Function{Name_: function}},
+		Arguments: args,
+	}
+}
+
+func TestBuildCallTreeRecursion(t *testing.T) {
+	main := frameAt("main.main", 13)
+	fib := func(n string, line int) api.Stackframe { return frameAt("main.fib", line, intVar("n", n)) }
+	returned := newStackStep(fib("2", 9), main)
+	returned.ReturnValues = []api.Variable{intVar("~r0", "1")}
+	steps := []Step{
+		newStackStep(main),
+		newStackStep(fib("2", 5), main),
+		newStackStep(fib("2", 9), main),
+		newStackStep(fib("1", 5), fib("2", 9), main),
+		returned,
+		// the second recursive call happens at the same depth as the first one
+		newStackStep(fib("0", 5), fib("2", 9), main),
+		newStackStep(fib("2", 9), main),
+		newStackStep(main),
+	}
+
+	roots := BuildCallTree(steps)
+
+	if len(roots) != 1 || roots[0].Function != "main.main" || roots[0].LastStep != 7 {
+		t.Fatalf("unexpected roots: %+v", roots)
+	}
+	if len(roots[0].Children) != 1 {
+		t.Fatalf("expected main to call fib once, got %d calls", len(roots[0].Children))
+	}
+	outer := roots[0].Children[0]
+	if outer.FirstStep != 1 || outer.LastStep != 6 {
+		t.Errorf("outer fib: got steps %d-%d, want 1-6", outer.FirstStep, outer.LastStep)
+	}
+	if len(outer.Children) != 2 {
+		t.Fatalf("expected outer fib to make 2 calls, got %d", len(outer.Children))
+	}
+	first, second := outer.Children[0], outer.Children[1]
+	if first.Args[0].Value != "1" || first.FirstStep != 3 || first.LastStep != 3 {
+		t.Errorf("first call: got n=%s steps %d-%d", first.Args[0].Value, first.FirstStep, first.LastStep)
+	}
+	if len(first.ReturnValues) != 1 || first.ReturnValues[0].Value != "1" {
+		t.Errorf("first call: got return values %+v", first.ReturnValues)
+	}
+	if second.Args[0].Value != "0" || second.FirstStep != 5 {
+		t.Errorf("second call: got n=%s first step %d", second.Args[0].Value, second.FirstStep)
+	}
+
+	stats := ComputeStats(steps)
+	if stats.FunctionCalls["main.fib"] != 3 || stats.FunctionCalls["main.main"] != 1 {
+		t.Errorf("unexpected function calls: %v", stats.FunctionCalls)
+	}
+}
@@ -0,0 +1,178 @@
+package serialize
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// ChangeKind tells how a variable differs from the last time its frame was seen
+type ChangeKind string
+
+const (
+	VariableCreated ChangeKind = "created"
+	VariableChanged ChangeKind = "changed"
+	VariableRemoved ChangeKind = "removed"
+)
+
+// VariableChange is a variable that was created, changed or went out of scope in a step
+type VariableChange struct {
+	VariableFrame
+	Name string `json:"name"`
+	// DeclLine tells apart variables of the same name declared in different blocks of the function
+	DeclLine int64      `json:"declLine,omitempty"`
+	Kind     ChangeKind `json:"kind"`
+	// Value is the value in this step, empty for removed variables
+	Value string `json:"value,omitempty"`
+}
+
+// VariableFrame locates the frame of a variable in the step's GoroutinesData, it's shared by the annotations
+// of the variables of the steps
+type VariableFrame struct {
+	// Goroutine is the ID of the goroutine, 0 for package variables
+	Goroutine int64 `json:"goroutine,omitempty"`
+	// Frame is the index of the frame in the goroutine's stacktrace
+	Frame    int    `json:"frame"`
+	Function string `json:"function,omitempty"`
+}
+
+// frameKey identifies a stack frame by its goroutine and its depth in the stack
+type frameKey struct {
+	goroutine int64
+	depth     int
+}
+
+// variableKey identifies a variable within its frame
+type variableKey struct {
+	name     string
+	declLine int64
+}
+
+// frameState is the last seen state of a stack frame
+type frameState struct {
+	function string
+	// variables keeps the declaration order so removed variables are reported in a stable order
+	variables []variableKey
+	values    map[variableKey]string
+}
+
+// AnnotateChanges sets Changes on every step to the variables that were created, changed or went
+// out of scope since their frame was last seen, the frames in main.go and in the libraries stepped into
+// of every goroutine are compared along with the package variables. Variables of frames that returned are not reported as removed.
+func AnnotateChanges(steps []Step) {
+	// the package variables are kept under the zero key, no frame of a goroutine has it
+	frames := map[frameKey]*frameState{}
+	for i := range steps {
+		step := &steps[i]
+		step.Changes = nil
+		forEachFrame(step, func(at variableFrame, vars []api.Variable) {
+			current := newFrameState(at.Function, vars)
+			previous := frames[at.key]
+			if previous != nil && previous.function != current.function {
+				previous = nil
+			}
+			step.Changes = appendChanges(step.Changes, VariableChange{VariableFrame: at.VariableFrame}, previous, current)
+			frames[at.key] = current
+		})
+	}
+}
+
+// variableFrame locates the frame of the variables passed to forEachFrame, goroutine is 0 for package variables.
+// file and line are where the frame is stopped, they are empty for package variables
+type variableFrame struct {
+	VariableFrame
+	key  frameKey
+	file string
+	line int
+}
+
+// forEachFrame calls fn with the package variables and with the variables of every frame compared by AnnotateChanges
+func forEachFrame(step *Step, fn func(at variableFrame, vars []api.Variable)) {
+	fn(variableFrame{}, step.PackageVariables)
+	for _, data := range step.GoroutinesData {
+		if data.Goroutine == nil {
+			continue
+		}
+		for j, frame := range data.Stacktrace {
+			if !isInMainDotGo(frame.File) && !slices.Contains(data.LibraryFrames, j) {
+				continue
+			}
+			vars := append(append([]api.Variable{}, frame.Arguments...), frame.Locals...)
+			fn(variableFrame{
+				VariableFrame: VariableFrame{Goroutine: data.Goroutine.ID, Frame: j, Function: frame.Function.Name()},
+				key:           frameKey{goroutine: data.Goroutine.ID, depth: len(data.Stacktrace) - j},
+				file:          frame.File,
+				line:          frame.Line,
+			}, vars)
+		}
+	}
+}
+
+func newFrameState(function string, vars []api.Variable) *frameState {
+	state := &frameState{function: function, values: make(map[variableKey]string, len(vars))}
+	for _, variable := range vars {
+		key := variableKey{name: variable.Name, declLine: variable.DeclLine}
+		state.variables = append(state.variables, key)
+		state.values[key] = variable.SinglelineString()
+	}
+	return state
+}
+
+// appendChanges compares the frame's variables with its previous state, every variable is created
+// when there is no previous state
+func appendChanges(changes []VariableChange, at VariableChange, previous, current *frameState) []VariableChange {
+	for _, key := range current.variables {
+		change := at
+		change.Name, change.DeclLine, change.Value = key.name, key.declLine, current.values[key]
+		var previousValue string
+		var seen bool
+		if previous != nil {
+			previousValue, seen = previous.values[key]
+		}
+		switch {
+		case !seen:
+			change.Kind = VariableCreated
+		case previousValue != change.Value:
+			change.Kind = VariableChanged
+		default:
+			continue
+		}
+		changes = append(changes, change)
+	}
+	if previous == nil {
+		return changes
+	}
+	for _, key := range previous.variables {
+		if _, ok := current.values[key]; ok {
+			continue
+		}
+		change := at
+		change.Name, change.DeclLine, change.Kind = key.name, key.declLine, VariableRemoved
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// assignedVariables returns the goroutine:name:declLine keys of the variables created or changed
+// in the current frame or in the package at the step
+func assignedVariables(step *Step) map[string]bool {
+	goroutine := step.GoroutinesData[0].Goroutine.ID
+	assigned := map[string]bool{}
+	for _, change := range step.Changes {
+		if change.Kind != VariableRemoved && (change.Goroutine == 0 || change.Goroutine == goroutine && change.Frame == 0) {
+			assigned[fmt.Sprintf("%d:%s:%d", change.Goroutine, change.Name, change.DeclLine)] = true
+		}
+	}
+	return assigned
+}
+
+// rootVariable returns the variable a path like "*p", "s[0]" or "p.items" starts from
+func rootVariable(path string) string {
+	path = strings.TrimLeft(path, "*")
+	if i := strings.IndexAny(path, "[."); i != -1 {
+		return path[:i]
+	}
+	return path
+}
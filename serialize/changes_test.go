@@ -0,0 +1,42 @@
+package serialize
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnnotateChanges(t *testing.T) {
+	steps := []Step{
+		newTestStep(1, "main.main", 6, intVar("sum", "0")),
+		newTestStep(1, "main.main", 7, intVar("sum", "0"), intVar("i", "0")),
+		newTestStep(1, "main.main", 8, intVar("sum", "1"), intVar("i", "0")),
+		newTestStep(1, "main.main", 10, intVar("sum", "1")),
+	}
+	AnnotateChanges(steps)
+
+	main := VariableFrame{Goroutine: 1, Function: "main.main"}
+	want := [][]VariableChange{
+		{{VariableFrame: main, Name: "sum", Kind: VariableCreated, Value: "0"}},
+		{{VariableFrame: main, Name: "i", Kind: VariableCreated, Value: "0"}},
+		{{VariableFrame: main, Name: "sum", Kind: VariableChanged, Value: "1"}},
+		{{VariableFrame: main, Name: "i", Kind: VariableRemoved}},
+	}
+	for i := range steps {
+		if !reflect.DeepEqual(steps[i].Changes, want[i]) {
+			t.Errorf("step %d: got %+v, want %+v", i, steps[i].Changes, want[i])
+		}
+	}
+}
+
+func TestAnnotateChangesNewFunction(t *testing.T) {
+	steps := []Step{
+		newTestStep(1, "main.first", 6, intVar("n", "1")),
+		newTestStep(1, "main.second", 12, intVar("n", "1")),
+	}
+	AnnotateChanges(steps)
+
+	want := []VariableChange{{VariableFrame: VariableFrame{Goroutine: 1, Function: "main.second"}, Name: "n", Kind: VariableCreated, Value: "1"}}
+	if !reflect.DeepEqual(steps[1].Changes, want) {
+		t.Errorf("got %+v, want %+v", steps[1].Changes, want)
+	}
+}
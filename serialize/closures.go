@@ -0,0 +1,99 @@
+package serialize
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// Closure is a function value held by a variable, decoded into the function it calls and the variables it captured
+type Closure struct {
+	VariableFrame
+	// Name is the path to the function value from the variable holding it, e.g. "next" or "handlers[0]"
+	Name     string `json:"name"`
+	DeclLine int64  `json:"declLine,omitempty"`
+	// Func is the function called through the value, e.g. "main.counter.func1"
+	Func     string             `json:"func"`
+	Captured []CapturedVariable `json:"captured,omitempty"`
+}
+
+// CapturedVariable is a variable captured by a closure
+type CapturedVariable struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	// ByReference is set when the closure shares the variable with the function that created it, and with the
+	// other closures capturing it, instead of holding a copy made when the closure was created
+	ByReference bool `json:"byReference,omitempty"`
+	// Address tells apart the variables captured by reference, closures sharing a variable have the same address
+	Address uint64 `json:"address,omitempty"`
+}
+
+// AnnotateClosures sets Closures on every step to the non nil function values held by the variables of the
+// frames compared by AnnotateChanges and by the package variables, including the ones in struct fields,
+// behind pointers and in the elements of arrays and slices
+func AnnotateClosures(steps []Step) {
+	for i := range steps {
+		step := &steps[i]
+		step.Closures = nil
+		forEachFrame(step, func(at variableFrame, vars []api.Variable) {
+			for j := range vars {
+				walkVariables(&vars[j], vars[j].Name, func(name string, variable *api.Variable) {
+					if reflect.Kind(variable.Kind) != reflect.Func || variable.Value == "" || variable.Unreadable != "" {
+						return
+					}
+					step.Closures = append(step.Closures, Closure{
+						VariableFrame: at.VariableFrame,
+						Name:          name,
+						DeclLine:      vars[j].DeclLine,
+						Func:          variable.Value,
+						Captured:      capturedVariables(variable),
+					})
+				})
+			}
+		})
+	}
+}
+
+// capturedVariables decodes the closure context delve loads as the children of a function value, variables
+// captured by reference are stored as pointers in the context and delve marks them as escaped once dereferenced
+func capturedVariables(fn *api.Variable) []CapturedVariable {
+	var captured []CapturedVariable
+	for i := range fn.Children {
+		child := &fn.Children[i]
+		variable := CapturedVariable{
+			Name:        strings.TrimPrefix(child.Name, "&"),
+			Type:        child.Type,
+			Value:       child.SinglelineString(),
+			ByReference: child.Flags&api.VariableEscaped != 0,
+		}
+		if variable.ByReference {
+			variable.Address = child.Addr
+		}
+		captured = append(captured, variable)
+	}
+	return captured
+}
+
+// closureDetails describes the closures assigned in the current frame or to package variables at the step
+func closureDetails(step *Step) []string {
+	assigned := assignedVariables(step)
+	var details []string
+	for _, closure := range step.Closures {
+		if len(closure.Captured) == 0 || !assigned[fmt.Sprintf("%d:%s:%d", closure.Goroutine, rootVariable(closure.Name), closure.DeclLine)] {
+			continue
+		}
+		var captured []string
+		for _, variable := range closure.Captured {
+			how := "by value"
+			if variable.ByReference {
+				how = "by reference"
+			}
+			captured = append(captured, fmt.Sprintf("%s = %s %s", variable.Name, variable.Value, how))
+		}
+		details = append(details, fmt.Sprintf("%s is %s capturing %s", closure.Name, strings.TrimPrefix(closure.Func, "main."), strings.Join(captured, ", ")))
+	}
+	return details
+}
@@ -0,0 +1,36 @@
+package serialize
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+func TestAnnotateClosures(t *testing.T) {
+	n := intVar("n", "2")
+	n.Flags, n.Addr = api.VariableEscaped, 0xc000012000
+	next := api.Variable{Name: "next", Type: "func() int", Kind: 19, Value: "main.counter.func1", DeclLine: 15, Children: []api.Variable{n, intVar("step", "2")}}
+	fs := api.Variable{Name: "fs", Type: "[]func()", Kind: 23, Len: 1, Cap: 1, Children: []api.Variable{
+		{Type: "func()", Kind: 19, Value: "main.main.func1", Children: []api.Variable{intVar("i", "0")}},
+	}}
+	var none api.Variable
+	none.Name, none.Kind = "handler", 19
+
+	steps := []Step{newTestStep(1, "main.main", 16, next, fs, none)}
+	AnnotateClosures(steps)
+
+	main := VariableFrame{Goroutine: 1, Function: "main.main"}
+	want := []Closure{
+		{VariableFrame: main, Name: "next", DeclLine: 15, Func: "main.counter.func1", Captured: []CapturedVariable{
+			{Name: "n", Type: "int", Value: "2", ByReference: true, Address: 0xc000012000},
+			{Name: "step", Type: "int", Value: "2"},
+		}},
+		{VariableFrame: main, Name: "fs[0]", Func: "main.main.func1", Captured: []CapturedVariable{
+			{Name: "i", Type: "int", Value: "0"},
+		}},
+	}
+	if !reflect.DeepEqual(steps[0].Closures, want) {
+		t.Errorf("got %+v, want %+v", steps[0].Closures, want)
+	}
+}
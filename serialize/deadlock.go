@@ -0,0 +1,283 @@
+package serialize
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"strconv"
+	"strings"
+
+	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/service/api"
+)
+
+// Deadlock describes the goroutines that were blocked when the runtime detected that all goroutines are asleep
+type Deadlock struct {
+	Message           string             `json:"message"`
+	BlockedGoroutines []BlockedGoroutine `json:"blockedGoroutines"`
+}
+
+// BlockedGoroutine is a goroutine parked at the time of the deadlock
+type BlockedGoroutine struct {
+	ID         int64  `json:"id"`
+	WaitReason string `json:"waitReason"`
+	// BlockedOn is the source expression of the channel, mutex or WaitGroup the goroutine waits for,
+	// empty when it can't be told from the blocking statement
+	BlockedOn string `json:"blockedOn,omitempty"`
+	// BlockedOnValue is the value of BlockedOn at the time of the deadlock
+	BlockedOnValue *api.Variable `json:"blockedOnValue,omitempty"`
+	// Location is the line in main.go where the goroutine is blocked
+	Location api.Location `json:"location"`
+}
+
+// isFatalThrow checks if the program stopped on the breakpoint delve sets on runtime fatal errors
+func isFatalThrow(debugState *api.DebuggerState) bool {
+	return debugState.CurrentThread != nil &&
+		debugState.CurrentThread.Breakpoint != nil &&
+		debugState.CurrentThread.Breakpoint.Name == proc.FatalThrow
+}
+
+// _deadlockMessage is the start of the message the runtime throws when it finds all goroutines asleep
+const _deadlockMessage = "all goroutines are asleep"
+
+// buildFatalStep builds the final step of a program stopped on a fatal error. The runtime finding all goroutines
+// asleep gives a deadlock step, any other fatal error, e.g. concurrent map writes, gives a step at the user code
+// of the goroutine that threw, built after running the program to its exit so the runtime's report is in its output.
+func (v *Serializer) buildFatalStep(ctx context.Context, debugState *api.DebuggerState) (Step, error) {
+	message := v.fatalMessage(ctx)
+	if strings.HasPrefix(message, _deadlockMessage) {
+		return v.buildDeadlockStep(ctx, message)
+	}
+	var step Step
+	if goroutine := debugState.SelectedGoroutine; goroutine != nil {
+		stacktrace, err := v.client.Stacktrace(ctx, goroutine.ID, 100, 0, nil)
+		if err != nil {
+			return Step{}, fmt.Errorf("goroutine: %d, stacktrace: %w", goroutine.ID, err)
+		}
+		if frame := firstUserFrame(stacktrace); frame != -1 {
+			step, err = v.buildStepAt(ctx, goroutine, stacktrace[frame].Location)
+			if err != nil {
+				return Step{}, err
+			}
+			step.FatalError = message
+		}
+	}
+	err := v.continueToExit(ctx)
+	if err != nil {
+		return Step{}, fmt.Errorf("fatal error %q: %w", message, err)
+	}
+	return step, nil
+}
+
+// buildDeadlockStep builds the final step of a program the runtime found deadlocked,
+// the step is only valid if a goroutine is blocked in user code
+func (v *Serializer) buildDeadlockStep(ctx context.Context, message string) (Step, error) {
+	goroutines, err := v.getUserGoroutines(ctx)
+	if err != nil {
+		return Step{}, fmt.Errorf("get user goroutines: %w", err)
+	}
+	stacktraces := map[int64][]api.Stackframe{}
+	for _, goroutine := range goroutines {
+		if goroutine.Status != api.GoroutineWaiting {
+			continue
+		}
+		stacktraces[goroutine.ID], err = v.client.Stacktrace(ctx, goroutine.ID, 100, 0, nil)
+		if err != nil {
+			return Step{}, fmt.Errorf("goroutine: %d, stacktrace: %w", goroutine.ID, err)
+		}
+	}
+
+	blocked, frames := blockedGoroutines(goroutines, stacktraces, v.waitReasonNamer(ctx))
+	if len(blocked) == 0 {
+		return Step{}, nil
+	}
+	selected := 0
+	for i := range blocked {
+		v.readBlockedOn(ctx, &blocked[i], frames[i])
+		if blocked[i].ID == 1 {
+			// the main goroutine is shown when it's blocked, the first blocked goroutine otherwise
+			selected = i
+		}
+	}
+	var goroutine *api.Goroutine
+	for _, g := range goroutines {
+		if g.ID == blocked[selected].ID {
+			goroutine = g
+		}
+	}
+	step, err := v.buildStepAt(ctx, goroutine, blocked[selected].Location)
+	if err != nil {
+		return Step{}, fmt.Errorf("building deadlock step: %w", err)
+	}
+	step.Deadlock = &Deadlock{Message: message, BlockedGoroutines: blocked}
+	return step, nil
+}
+
+// buildStepAt builds the step of a goroutine stopped in the runtime at the given location of its user code
+// rather than inside the runtime, the runtime frames are dropped so the top frame is the user code as in any other step
+func (v *Serializer) buildStepAt(ctx context.Context, goroutine *api.Goroutine, loc api.Location) (Step, error) {
+	userGoroutine := *goroutine
+	userGoroutine.CurrentLoc = loc
+	step, err := v.buildStep(ctx, &api.DebuggerState{SelectedGoroutine: &userGoroutine})
+	if err != nil {
+		return Step{}, err
+	}
+	stacktrace := step.GoroutinesData[0].Stacktrace
+	if frame := firstUserFrame(stacktrace); frame != -1 {
+		step.GoroutinesData[0].Stacktrace = stacktrace[frame:]
+	}
+	return step, nil
+}
+
+// continueToExit runs the program until it exits, e.g. after a fatal error so the runtime writes its report
+func (v *Serializer) continueToExit(ctx context.Context) error {
+	for ctx.Err() == nil {
+		debugState, err := v.client.Continue(ctx)
+		if err != nil {
+			return fmt.Errorf("continue: %w", err)
+		}
+		if debugState.Exited {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
+
+// firstUserFrame returns the index of the innermost frame in main.go, -1 if there is none
+func firstUserFrame(stacktrace []api.Stackframe) int {
+	for i := range stacktrace {
+		if isInMainDotGo(stacktrace[i].File) {
+			return i
+		}
+	}
+	return -1
+}
+
+// blockedGoroutines lists the waiting goroutines that are blocked in main.go along with the index of the frame
+// blocked there, the stacktraces are by goroutine ID
+func blockedGoroutines(goroutines []*api.Goroutine, stacktraces map[int64][]api.Stackframe, waitReason func(int64) string) ([]BlockedGoroutine, []int) {
+	var blocked []BlockedGoroutine
+	var frames []int
+	for _, goroutine := range goroutines {
+		if goroutine.Status != api.GoroutineWaiting {
+			continue
+		}
+		b, frame, ok := newBlockedGoroutine(goroutine, stacktraces[goroutine.ID], waitReason)
+		if !ok {
+			continue
+		}
+		blocked = append(blocked, b)
+		frames = append(frames, frame)
+	}
+	return blocked, frames
+}
+
+// newBlockedGoroutine describes where the goroutine is in main.go and returns the index of the frame there,
+// ok is false if it isn't in user code. The value it's blocked on is left for readBlockedOn.
+func newBlockedGoroutine(goroutine *api.Goroutine, stacktrace []api.Stackframe, waitReason func(int64) string) (blocked BlockedGoroutine, frame int, ok bool) {
+	frame = firstUserFrame(stacktrace)
+	if frame == -1 {
+		return blocked, -1, false
+	}
+	return BlockedGoroutine{
+		ID:         goroutine.ID,
+		WaitReason: waitReason(goroutine.WaitReason),
+		BlockedOn:  blockingExpression(stacktrace[frame].File, stacktrace[frame].Line),
+		Location:   stacktrace[frame].Location,
+	}, frame, true
+}
+
+// fatalMessage reads the message passed to the runtime function that threw the fatal error
+func (v *Serializer) fatalMessage(ctx context.Context) string {
+	message, err := v.client.EvalVariable(ctx, api.EvalScope{GoroutineID: -1}, "s", defaultLoadConfig)
+	if err != nil {
+		v.logger.Debug().Err(err).Msg("failed to read fatal error message")
+		return ""
+	}
+	return message.Value
+}
+
+// readBlockedOn reads the value the goroutine is blocked on, the frame is the one blocked in main.go
+func (v *Serializer) readBlockedOn(ctx context.Context, blocked *BlockedGoroutine, frame int) {
+	if blocked.BlockedOn == "" {
+		return
+	}
+	value, err := v.client.EvalVariable(ctx, api.EvalScope{GoroutineID: blocked.ID, Frame: frame}, blocked.BlockedOn, v.loadConfig)
+	if err == nil {
+		blocked.BlockedOnValue = value
+	}
+}
+
+// waitReasonNamer returns a function converting the wait reasons to their names using the table of the traced
+// program's runtime, as the numbering changes between Go versions
+func (v *Serializer) waitReasonNamer(ctx context.Context) func(int64) string {
+	return func(reason int64) string {
+		expr := fmt.Sprintf("runtime.waitReasonStrings[%d]", reason)
+		name, err := v.client.EvalVariable(ctx, api.EvalScope{GoroutineID: -1}, expr, defaultLoadConfig)
+		if err != nil {
+			return strconv.FormatInt(reason, 10)
+		}
+		return name.Value
+	}
+}
+
+// blockingExpression finds the channel of a send or receive, or the receiver of a
+// Wait, Lock or RLock call in the statement at the given line
+func blockingExpression(filePath string, line int) string {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filePath, nil, 0)
+	if err != nil {
+		return ""
+	}
+	var found ast.Expr
+	ast.Inspect(file, func(node ast.Node) bool {
+		if found != nil || node == nil {
+			return false
+		}
+		start, end := fset.Position(node.Pos()).Line, fset.Position(node.End()).Line
+		if line < start || line > end {
+			return false
+		}
+		switch n := node.(type) {
+		case *ast.SendStmt:
+			if start == line {
+				found = n.Chan
+			}
+		case *ast.UnaryExpr:
+			if n.Op == token.ARROW && start == line {
+				found = n.X
+			}
+		case *ast.CallExpr:
+			selector, ok := n.Fun.(*ast.SelectorExpr)
+			if ok && start == line && (selector.Sel.Name == "Wait" || selector.Sel.Name == "Lock" || selector.Sel.Name == "RLock") {
+				found = selector.X
+			}
+		}
+		return true
+	})
+	if found == nil {
+		return ""
+	}
+	var b bytes.Buffer
+	if err := printer.Fprint(&b, fset, found); err != nil {
+		return ""
+	}
+	return b.String()
+}
+
+// describe tells the narrative the message of the runtime followed by where the goroutines are blocked
+func (d *Deadlock) describe() []string {
+	details := []string{d.Message}
+	for _, blocked := range d.BlockedGoroutines {
+		detail := fmt.Sprintf("goroutine %d is blocked at line %d (%s)", blocked.ID, blocked.Location.Line, blocked.WaitReason)
+		if blocked.BlockedOn != "" {
+			detail = fmt.Sprintf("goroutine %d is blocked on %s at line %d (%s)", blocked.ID, blocked.BlockedOn, blocked.Location.Line, blocked.WaitReason)
+		}
+		details = append(details, detail)
+	}
+	return details
+}
@@ -0,0 +1,126 @@
+package serialize
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/service/api"
+)
+
+const _deadlockSource = `package main
+
+import "sync"
+
+func main() {
+	ch := make(chan int)
+	results := map[string]chan int{"a": ch}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	ch <- 1
+	v := <-results["a"]
+	mu.Lock()
+	wg.Wait()
+	println(v)
+	select {
+	case <-ch:
+	}
+}
+`
+
+func writeDeadlockSource(t *testing.T) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(file, []byte(_deadlockSource), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestBlockingExpression(t *testing.T) {
+	file := writeDeadlockSource(t)
+	tests := []struct {
+		name string
+		line int
+		want string
+	}{
+		{name: "send", line: 10, want: "ch"},
+		{name: "receive", line: 11, want: `results["a"]`},
+		{name: "lock", line: 12, want: "mu"},
+		{name: "wait", line: 13, want: "wg"},
+		{name: "select case", line: 16, want: "ch"},
+		{name: "no blocking statement", line: 14, want: ""},
+		{name: "declaration", line: 6, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := blockingExpression(file, tt.line); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if got := blockingExpression(filepath.Join(t.TempDir(), "missing.go"), 10); got != "" {
+		t.Errorf("got %q for a missing file", got)
+	}
+}
+
+func TestBlockedGoroutines(t *testing.T) {
+	file := writeDeadlockSource(t)
+	userFrame := func(line int) api.Stackframe {
+		return api.Stackframe{Location: api.Location{File: file, Line: line, Function: &api.Function{Name_: "main.main"}}}
+	}
+	runtimeFrame := api.Stackframe{Location: api.Location{File: "/usr/local/go/src/runtime/proc.go", Line: 435, Function: &api.Function{Name_: "runtime.gopark"}}}
+	waitReason := func(reason int64) string { return "reason " + strconv.FormatInt(reason, 10) }
+
+	tests := []struct {
+		name        string
+		goroutines  []*api.Goroutine
+		stacktraces map[int64][]api.Stackframe
+		want        []BlockedGoroutine
+		wantFrames  []int
+	}{
+		{
+			name:        "blocked in main.go below the runtime frames",
+			goroutines:  []*api.Goroutine{{ID: 1, Status: api.GoroutineWaiting, WaitReason: 7}},
+			stacktraces: map[int64][]api.Stackframe{1: {runtimeFrame, userFrame(10)}},
+			want:        []BlockedGoroutine{{ID: 1, WaitReason: "reason 7", BlockedOn: "ch", Location: userFrame(10).Location}},
+			wantFrames:  []int{1},
+		},
+		{
+			name: "running goroutines are not blocked",
+			goroutines: []*api.Goroutine{
+				{ID: 1, Status: proc.Grunning},
+				{ID: 2, Status: api.GoroutineWaiting, WaitReason: 3},
+			},
+			stacktraces: map[int64][]api.Stackframe{1: {userFrame(14)}, 2: {runtimeFrame, userFrame(12)}},
+			want:        []BlockedGoroutine{{ID: 2, WaitReason: "reason 3", BlockedOn: "mu", Location: userFrame(12).Location}},
+			wantFrames:  []int{1},
+		},
+		{
+			name:        "goroutines outside of main.go are skipped",
+			goroutines:  []*api.Goroutine{{ID: 3, Status: api.GoroutineWaiting}},
+			stacktraces: map[int64][]api.Stackframe{3: {runtimeFrame}},
+		},
+		{
+			name:        "blocked on a statement without a blocking expression",
+			goroutines:  []*api.Goroutine{{ID: 1, Status: api.GoroutineWaiting, WaitReason: 1}},
+			stacktraces: map[int64][]api.Stackframe{1: {userFrame(14)}},
+			want:        []BlockedGoroutine{{ID: 1, WaitReason: "reason 1", Location: userFrame(14).Location}},
+			wantFrames:  []int{0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocked, frames := blockedGoroutines(tt.goroutines, tt.stacktraces, waitReason)
+			if !reflect.DeepEqual(blocked, tt.want) {
+				t.Errorf("got %+v, want %+v", blocked, tt.want)
+			}
+			if !reflect.DeepEqual(frames, tt.wantFrames) {
+				t.Errorf("got frames %v, want %v", frames, tt.wantFrames)
+			}
+		})
+	}
+}
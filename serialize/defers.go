@@ -0,0 +1,337 @@
+package serialize
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// _deferBreakpoint prefixes the breakpoints set on the recorded functions the goroutines deferred, see armDeferBreakpoints
+const _deferBreakpoint = "defer"
+
+// DeferredCall is a call deferred by a frame that didn't return yet
+type DeferredCall struct {
+	// Frame is the index in the goroutine's stacktrace of the frame that deferred the call
+	Frame    int    `json:"frame"`
+	Function string `json:"function"`
+	// Call is the deferred call as written in the defer statement
+	Call string `json:"call,omitempty"`
+	// Line is the line of the defer statement
+	Line int `json:"line"`
+	// Arguments holds the values the arguments were evaluated to by the defer statement, named after their expressions
+	Arguments  []api.Variable `json:"arguments,omitempty"`
+	Unreadable string         `json:"unreadable,omitempty"`
+}
+
+// deferKey identifies a deferred call across steps, calls deferred by the same statement of the same frame,
+// as in a loop, are told apart by their position among them counting from the first deferred
+type deferKey struct {
+	goroutine int64
+	sp        uint64
+	pc        uint64
+	ordinal   int
+}
+
+// pendingDefer is a deferred call that didn't run yet
+type pendingDefer struct {
+	key deferKey
+	// depth is the depth of the deferring frame in the stack, it doesn't change while the call is pending
+	depth int
+	// pc is the entry of the deferred function, 0 when it's not recorded so no breakpoint is armed there
+	pc   uint64
+	call DeferredCall
+}
+
+// upcomingDefer holds the arguments of the defer statement a frame is about to run
+type upcomingDefer struct {
+	depth     int
+	line      int
+	arguments []api.Variable
+}
+
+// deferStatement is a defer statement of the source
+type deferStatement struct {
+	call string
+	args []string
+}
+
+// readDefers lists the pending deferred calls of the recorded frames, in the order they will run, and drops
+// delve's defer records from the frames. The arguments of a call seen for the first time are the ones evaluated
+// on the defer statement by prepareDeferArguments, they are unreadable if the statement wasn't stopped at.
+func (v *Serializer) readDefers(goroutine int64, stacktrace []api.Stackframe) []pendingDefer {
+	var pending []pendingDefer
+	// keep the arguments of the calls still pending only, a call deferred later may get the key of one that ran
+	previousArguments := v.deferArguments[goroutine]
+	currentArguments := map[deferKey][]api.Variable{}
+	for i := range stacktrace {
+		frame := &stacktrace[i]
+		defers := frame.Defers
+		frame.Defers = nil
+		if !v.isRecorded(frame.Location) {
+			continue
+		}
+		ordinals := map[uint64]int{}
+		// delve lists the most recently deferred call first, count the ordinals from the other end
+		for j := len(defers) - 1; j >= 0; j-- {
+			d := defers[j]
+			key := deferKey{goroutine: goroutine, sp: d.SP, pc: d.DeferLoc.PC, ordinal: ordinals[d.DeferLoc.PC]}
+			ordinals[d.DeferLoc.PC]++
+			call := DeferredCall{Frame: i, Line: d.DeferLoc.Line, Unreadable: d.Unreadable}
+			if d.DeferredLoc.Function != nil {
+				call.Function = d.DeferredLoc.Function.Name()
+			}
+			if statement, ok := v.deferStatementAt(d.DeferLoc.File, d.DeferLoc.Line); ok {
+				call.Call = statement.call
+				arguments, ok := previousArguments[key]
+				if !ok {
+					upcoming, ok := v.upcomingDefers[goroutine]
+					if ok && upcoming.depth == len(stacktrace)-i && upcoming.line == d.DeferLoc.Line {
+						arguments = upcoming.arguments
+					} else {
+						// evaluating them now would give their current values instead of the deferred ones
+						arguments = unreadableDeferArguments(statement.args)
+					}
+				}
+				currentArguments[key] = arguments
+				call.Arguments = arguments
+			}
+			p := pendingDefer{key: key, depth: len(stacktrace) - i, call: call}
+			if v.isRecorded(d.DeferredLoc) {
+				p.pc = d.DeferredLoc.PC
+			}
+			pending = append(pending, p)
+		}
+		// restore the running order within the frame
+		frameDefers := pending[len(pending)-len(defers):]
+		for l, r := 0, len(frameDefers)-1; l < r; l, r = l+1, r-1 {
+			frameDefers[l], frameDefers[r] = frameDefers[r], frameDefers[l]
+		}
+	}
+	v.deferArguments[goroutine] = currentArguments
+	return pending
+}
+
+// prepareDeferArguments evaluates the arguments of the defer statement the top frame is stopped at, the variables
+// they refer to may be out of scope once the statement ran, e.g. at the end of a loop body
+func (v *Serializer) prepareDeferArguments(ctx context.Context, goroutine int64, stacktrace []api.Stackframe) {
+	delete(v.upcomingDefers, goroutine)
+	if len(stacktrace) == 0 {
+		return
+	}
+	statement, ok := v.deferStatementAt(stacktrace[0].File, stacktrace[0].Line)
+	if !ok {
+		return
+	}
+	v.upcomingDefers[goroutine] = upcomingDefer{
+		depth:     len(stacktrace),
+		line:      stacktrace[0].Line,
+		arguments: v.evalDeferArguments(ctx, goroutine, 0, statement.args),
+	}
+}
+
+// unreadableDeferArguments returns the arguments of a defer statement that ran before the trace stopped at it
+func unreadableDeferArguments(args []string) []api.Variable {
+	var arguments []api.Variable
+	for _, arg := range args {
+		arguments = append(arguments, api.Variable{Name: arg, Unreadable: "the defer statement ran before the trace stopped at it"})
+	}
+	return arguments
+}
+
+func (v *Serializer) evalDeferArguments(ctx context.Context, goroutine int64, frame int, args []string) []api.Variable {
+	var arguments []api.Variable
+	for _, arg := range args {
+		variable, err := v.client.EvalVariable(ctx, api.EvalScope{GoroutineID: goroutine, Frame: frame}, arg, v.loadConfig)
+		if err != nil {
+			// calls and other expressions delve can't evaluate without side effects
+			arguments = append(arguments, api.Variable{Name: arg, Unreadable: err.Error()})
+			continue
+		}
+		variable.Name = arg
+		arguments = append(arguments, *variable)
+	}
+	return arguments
+}
+
+// deferStatementAt returns the defer statement at the line of the file, the files are parsed once
+func (v *Serializer) deferStatementAt(file string, line int) (deferStatement, bool) {
+	statements, ok := v.deferStatements[file]
+	if !ok {
+		var err error
+		statements, err = parseDeferStatements(file)
+		if err != nil {
+			v.logger.Debug().Err(err).Str("file", file).Msg("parse defer statements")
+		}
+		v.deferStatements[file] = statements
+	}
+	statement, ok := statements[line]
+	return statement, ok
+}
+
+// parseDeferStatements maps the lines of the file to the defer statements starting there
+func parseDeferStatements(file string) (map[int]deferStatement, error) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read source: %w", err)
+	}
+	fset := token.NewFileSet()
+	parsed, err := parser.ParseFile(fset, file, src, 0)
+	if err != nil {
+		return nil, fmt.Errorf("parse source: %w", err)
+	}
+	text := func(node ast.Node) string {
+		return string(src[fset.Position(node.Pos()).Offset:fset.Position(node.End()).Offset])
+	}
+	statements := map[int]deferStatement{}
+	ast.Inspect(parsed, func(node ast.Node) bool {
+		stmt, ok := node.(*ast.DeferStmt)
+		if !ok {
+			return true
+		}
+		line := fset.Position(stmt.Pos()).Line
+		if _, ok := statements[line]; ok {
+			return true
+		}
+		statement := deferStatement{call: text(stmt.Call)}
+		for _, arg := range stmt.Call.Args {
+			statement.args = append(statement.args, text(arg))
+		}
+		if fn, ok := stmt.Call.Fun.(*ast.FuncLit); ok {
+			// keep the call on a single line
+			statement.call = text(fn.Type) + " {...}(" + strings.Join(statement.args, ", ") + ")"
+		}
+		statements[line] = statement
+		return true
+	})
+	return statements, nil
+}
+
+// deferredCalls returns the calls of the pending defers
+func deferredCalls(pending []pendingDefer) []DeferredCall {
+	var calls []DeferredCall
+	for _, p := range pending {
+		calls = append(calls, p.call)
+	}
+	return calls
+}
+
+// startedDefer returns the deferred call that started running if the goroutine is at the start of one of
+// the calls that were pending the last time it was seen and are not anymore
+func startedDefer(previous, current []pendingDefer, stacktrace []api.Stackframe) *DeferredCall {
+	if len(stacktrace) == 0 || stacktrace[0].Function == nil {
+		return nil
+	}
+	for _, p := range previous {
+		if p.call.Function != stacktrace[0].Function.Name() || containsDefer(current, p.key) {
+			continue
+		}
+		if !calledByDeferral(stacktrace, len(stacktrace)-p.depth) {
+			// a direct call of the function, the deferred one may run later
+			continue
+		}
+		call := p.call
+		call.Frame = len(stacktrace) - p.depth
+		return &call
+	}
+	return nil
+}
+
+// _deferRunners are the runtime functions running the deferred calls: on return, on panic and on runtime.Goexit
+var _deferRunners = []string{"runtime.deferreturn", "runtime.gopanic", "runtime.Goexit"}
+
+// calledByDeferral checks if the function at the top of the stack was called by the runtime running
+// the deferred calls of the frame at the given index, rather than called directly
+func calledByDeferral(stacktrace []api.Stackframe, deferring int) bool {
+	for _, frame := range stacktrace[1:min(max(deferring, 1), len(stacktrace))] {
+		if frame.Function != nil && slices.Contains(_deferRunners, frame.Function.Name()) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsDefer(pending []pendingDefer, key deferKey) bool {
+	for _, p := range pending {
+		if p.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// armDeferBreakpoints breaks at the entry of the recorded functions the goroutine deferred so the start of the
+// deferred calls is recorded even when the goroutine steps over or out of the deferring frame. The breakpoints are
+// set once the call is deferred and cleared when no pending call of the goroutine runs the function anymore.
+// Functions that are not recorded, e.g. fmt.Println, are left alone as a breakpoint there would stop every direct call too.
+func (v *Serializer) armDeferBreakpoints(ctx context.Context, goroutine int64, pending []pendingDefer) error {
+	armed := v.deferBreakpoints[goroutine]
+	if armed == nil {
+		armed = map[uint64]string{}
+		v.deferBreakpoints[goroutine] = armed
+	}
+	wanted := map[uint64]bool{}
+	for _, p := range pending {
+		if p.pc == 0 || wanted[p.pc] {
+			continue
+		}
+		wanted[p.pc] = true
+		if _, ok := armed[p.pc]; ok {
+			continue
+		}
+		name := fmt.Sprintf("%sG%dPC%#x", _deferBreakpoint, goroutine, p.pc)
+		_, err := v.client.CreateBreakpoint(ctx, &api.Breakpoint{
+			Name:  name,
+			Addrs: []uint64{p.pc},
+			Cond:  fmt.Sprintf("runtime.curg.goid == %d", goroutine),
+		})
+		if err != nil {
+			// another breakpoint may already be set there, it's not tried again while the call is pending
+			v.logger.Debug().Err(err).Str("breakpoint", name).Msg("create defer breakpoint")
+			name = ""
+		}
+		armed[p.pc] = name
+	}
+	for pc, name := range armed {
+		if wanted[pc] {
+			continue
+		}
+		if name != "" {
+			if _, err := v.client.ClearBreakpointByName(ctx, name); err != nil {
+				return fmt.Errorf("clear breakpoint: %s: %w", name, err)
+			}
+		}
+		delete(armed, pc)
+	}
+	return nil
+}
+
+// describe tells the narrative that the deferred call started running, along with the arguments it was deferred with
+func (call *DeferredCall) describe() string {
+	name := call.Call
+	if name == "" {
+		name = call.Function
+	}
+	detail := fmt.Sprintf("running %s deferred at line %d", name, call.Line)
+	var arguments []string
+	for _, arg := range call.Arguments {
+		if _, err := strconv.Unquote(arg.Name); err == nil || arg.Unreadable != "" {
+			continue
+		}
+		if _, err := strconv.ParseFloat(arg.Name, 64); err == nil {
+			continue
+		}
+		arguments = append(arguments, fmt.Sprintf("%s = %s", arg.Name, arg.SinglelineString()))
+	}
+	if len(arguments) > 0 {
+		detail += " with " + strings.Join(arguments, ", ")
+	}
+	return detail
+}
@@ -0,0 +1,125 @@
+package serialize
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/go-delve/delve/service/api"
+	"github.com/rs/zerolog"
+)
+
+const _deferSource = `package main
+
+import "fmt"
+
+func main() {
+	for i := range 3 {
+		defer fmt.Println("deferred", i)
+	}
+	defer func(n int) {
+		fmt.Println(n)
+	}(len("ab"))
+}
+`
+
+func TestParseDeferStatements(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(file, []byte(_deferSource), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	statements, err := parseDeferStatements(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 2 {
+		t.Fatalf("got %d statements, want 2", len(statements))
+	}
+	if got := statements[7]; got.call != `fmt.Println("deferred", i)` || !slices.Equal(got.args, []string{`"deferred"`, "i"}) {
+		t.Errorf("unexpected statement at line 7 %+v", got)
+	}
+	if got := statements[9]; got.call != `func(n int) {...}(len("ab"))` || !slices.Equal(got.args, []string{`len("ab")`}) {
+		t.Errorf("unexpected statement at line 9 %+v", got)
+	}
+}
+
+func TestStartedDefer(t *testing.T) {
+	first := pendingDefer{key: deferKey{goroutine: 1, sp: 0x100, pc: 0x10}, depth: 2, call: DeferredCall{Frame: 0, Function: "fmt.Println", Line: 7}}
+	second := pendingDefer{key: deferKey{goroutine: 1, sp: 0x100, pc: 0x10, ordinal: 1}, depth: 2, call: DeferredCall{Frame: 0, Function: "fmt.Println", Line: 7}}
+	previous := []pendingDefer{second, first}
+
+	stacktrace := func(functions ...string) []api.Stackframe {
+		var frames []api.Stackframe
+		for _, function := range functions {
+			frames = append(frames, api.Stackframe{Location: api.Location{Function: &api.Function{Name_: function}}})
+		}
+		return frames
+	}
+
+	if call := startedDefer(previous, previous, stacktrace("fmt.Println", "main.main", "runtime.main")); call != nil {
+		t.Errorf("got started call %+v while every call is pending", call)
+	}
+	if call := startedDefer(previous, []pendingDefer{first}, stacktrace("main.main", "runtime.main")); call != nil {
+		t.Errorf("got started call %+v outside of the deferred function", call)
+	}
+	if call := startedDefer(previous, []pendingDefer{first}, stacktrace("fmt.Println", "main.main", "runtime.main")); call != nil {
+		t.Errorf("got started call %+v for a direct call of the deferred function", call)
+	}
+	call := startedDefer(previous, []pendingDefer{first}, stacktrace("fmt.Println", "main.main.deferwrap1", "runtime.deferreturn", "main.main", "runtime.main"))
+	if call == nil {
+		t.Fatal("got no started call")
+	}
+	if call.Frame != 3 {
+		t.Errorf("got deferring frame %d, want 3", call.Frame)
+	}
+}
+
+func TestReadDefersNotStoppedAt(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(file, []byte(_deferSource), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	v := NewSerializer(nil, zerolog.Nop(), Options{})
+	main := api.Location{File: file, Line: 11, Function: &api.Function{Name_: "main.main"}}
+	stacktrace := []api.Stackframe{{
+		Location: main,
+		Defers: []api.Defer{
+			{
+				DeferLoc:    api.Location{File: file, Line: 9, PC: 0x20},
+				DeferredLoc: api.Location{File: file, Line: 9, PC: 0x200, Function: &api.Function{Name_: "main.main.func1"}},
+				SP:          0x100,
+			},
+			{
+				DeferLoc:    api.Location{File: file, Line: 7, PC: 0x10},
+				DeferredLoc: api.Location{File: "/usr/local/go/src/fmt/print.go", Line: 313, PC: 0x100, Function: &api.Function{Name_: "fmt.Println"}},
+				SP:          0x100,
+			},
+		},
+	}}
+
+	pending := v.readDefers(1, stacktrace)
+	if len(pending) != 2 {
+		t.Fatalf("got %d pending defers, want 2", len(pending))
+	}
+	if stacktrace[0].Defers != nil {
+		t.Error("the defer records were not dropped from the frame")
+	}
+	for _, p := range pending {
+		if len(p.call.Arguments) == 0 {
+			t.Errorf("%s: got no arguments", p.call.Function)
+		}
+		for _, arg := range p.call.Arguments {
+			if arg.Unreadable == "" {
+				t.Errorf("%s: argument %s was read after the defer statement ran", p.call.Function, arg.Name)
+			}
+		}
+	}
+	// only the deferred function in main.go gets a breakpoint
+	if pending[0].call.Function != "main.main.func1" || pending[0].pc != 0x200 {
+		t.Errorf("got first pending %s at %#x, want main.main.func1 at 0x200", pending[0].call.Function, pending[0].pc)
+	}
+	if pending[1].call.Function != "fmt.Println" || pending[1].pc != 0 {
+		t.Errorf("got second pending %s at %#x, want fmt.Println with no breakpoint", pending[1].call.Function, pending[1].pc)
+	}
+}
@@ -0,0 +1,106 @@
+package serialize
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DiagnosticKind is the decision of the compiler a diagnostic reports
+type DiagnosticKind string
+
+const (
+	DiagnosticMovedToHeap   DiagnosticKind = "moved-to-heap"
+	DiagnosticEscapes       DiagnosticKind = "escapes"
+	DiagnosticDoesNotEscape DiagnosticKind = "does-not-escape"
+	DiagnosticLeakingParam  DiagnosticKind = "leaking-param"
+	DiagnosticInlined       DiagnosticKind = "inlined"
+	DiagnosticCanInline     DiagnosticKind = "can-inline"
+	DiagnosticOther         DiagnosticKind = "other"
+)
+
+// CompilerDiagnostic is an escape analysis or inlining decision printed by the compiler with -gcflags=-m
+// for a line of main.go. The decisions are the ones of an optimized build, the traced binary is built
+// without optimizations so its locals may live elsewhere, but they tell why a value would be on the heap.
+type CompilerDiagnostic struct {
+	Line   int            `json:"line"`
+	Column int            `json:"column"`
+	Kind   DiagnosticKind `json:"kind"`
+	// Name is the variable, expression or function the diagnostic is about, e.g. "x" for "moved to heap: x"
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message"`
+}
+
+var diagnosticRegexp = regexp.MustCompile(`^(.+\.go):(\d+):(\d+): (.+)$`)
+
+// ParseCompilerDiagnostics extracts the diagnostics of main.go from the output of go build -gcflags=-m,
+// the lines that aren't diagnostics, e.g. the package banner, are skipped
+func ParseCompilerDiagnostics(output string) []CompilerDiagnostic {
+	var diagnostics []CompilerDiagnostic
+	for line := range strings.Lines(output) {
+		match := diagnosticRegexp.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil || !isInMainDotGo(match[1]) {
+			continue
+		}
+		diagnostic := CompilerDiagnostic{Message: match[4]}
+		diagnostic.Line, _ = strconv.Atoi(match[2])
+		diagnostic.Column, _ = strconv.Atoi(match[3])
+		diagnostic.Kind, diagnostic.Name = classifyDiagnostic(match[4])
+		diagnostics = append(diagnostics, diagnostic)
+	}
+	return diagnostics
+}
+
+// classifyDiagnostic returns the kind of the diagnostic message and what it is about
+func classifyDiagnostic(message string) (DiagnosticKind, string) {
+	firstWord := func(s string) string {
+		word, _, _ := strings.Cut(s, " ")
+		return word
+	}
+	switch {
+	case strings.HasPrefix(message, "moved to heap: "):
+		return DiagnosticMovedToHeap, strings.TrimPrefix(message, "moved to heap: ")
+	case strings.HasPrefix(message, "leaking param content: "):
+		return DiagnosticLeakingParam, firstWord(strings.TrimPrefix(message, "leaking param content: "))
+	case strings.HasPrefix(message, "leaking param: "):
+		return DiagnosticLeakingParam, firstWord(strings.TrimPrefix(message, "leaking param: "))
+	case strings.HasPrefix(message, "inlining call to "):
+		return DiagnosticInlined, firstWord(strings.TrimPrefix(message, "inlining call to "))
+	case strings.HasPrefix(message, "can inline "):
+		return DiagnosticCanInline, firstWord(strings.TrimPrefix(message, "can inline "))
+	case strings.HasSuffix(message, " escapes to heap"):
+		return DiagnosticEscapes, strings.TrimSuffix(message, " escapes to heap")
+	case strings.HasSuffix(message, " does not escape"):
+		return DiagnosticDoesNotEscape, strings.TrimSuffix(message, " does not escape")
+	}
+	return DiagnosticOther, ""
+}
+
+// AttachDiagnostics links the compiler diagnostics of the response to the steps where the main goroutine
+// is at their lines, diagnostics attached by a previous call are replaced
+func AttachDiagnostics(resp *ExecutionResponse) {
+	byLine := map[int][]int{}
+	for i, diagnostic := range resp.Diagnostics {
+		byLine[diagnostic.Line] = append(byLine[diagnostic.Line], i)
+	}
+	for i := range resp.Steps {
+		step := &resp.Steps[i]
+		step.Diagnostics = nil
+		if !step.isValid() || !isInMainDotGo(step.GoroutinesData[0].Goroutine.CurrentLoc.File) {
+			continue
+		}
+		step.Diagnostics = byLine[step.GoroutinesData[0].Goroutine.CurrentLoc.Line]
+	}
+}
+
+// describe tells the narrative the decision of the compiler, it's empty for the kinds not told
+func (diagnostic CompilerDiagnostic) describe() string {
+	switch diagnostic.Kind {
+	case DiagnosticMovedToHeap:
+		return fmt.Sprintf("%s lives on the heap: escape analysis moved it there", diagnostic.Name)
+	case DiagnosticInlined:
+		return fmt.Sprintf("the call to %s is inlined in optimized builds", diagnostic.Name)
+	}
+	return ""
+}
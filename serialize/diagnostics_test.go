@@ -0,0 +1,43 @@
+package serialize
+
+import (
+	"reflect"
+	"testing"
+)
+
+const _diagnosticsOutput = `# command-line-arguments
+./main.go:5:6: can inline add
+./main.go:12:13: inlining call to add
+/usr/local/go/src/fmt/print.go:10:2: moved to heap: buf
+./main.go:10:2: moved to heap: x
+./main.go:14:13: ... argument does not escape
+./main.go:14:14: x escapes to heap
+./main.go:7:11: leaking param: p to result ~r0 level=0
+`
+
+func TestParseCompilerDiagnostics(t *testing.T) {
+	want := []CompilerDiagnostic{
+		{Line: 5, Column: 6, Kind: DiagnosticCanInline, Name: "add", Message: "can inline add"},
+		{Line: 12, Column: 13, Kind: DiagnosticInlined, Name: "add", Message: "inlining call to add"},
+		{Line: 10, Column: 2, Kind: DiagnosticMovedToHeap, Name: "x", Message: "moved to heap: x"},
+		{Line: 14, Column: 13, Kind: DiagnosticDoesNotEscape, Name: "... argument", Message: "... argument does not escape"},
+		{Line: 14, Column: 14, Kind: DiagnosticEscapes, Name: "x", Message: "x escapes to heap"},
+		{Line: 7, Column: 11, Kind: DiagnosticLeakingParam, Name: "p", Message: "leaking param: p to result ~r0 level=0"},
+	}
+	if got := ParseCompilerDiagnostics(_diagnosticsOutput); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestAttachDiagnostics(t *testing.T) {
+	resp := ExecutionResponse{
+		Steps:       []Step{newTestStep(1, "main.main", 10), newTestStep(1, "main.main", 11), newTestStep(1, "main.main", 10)},
+		Diagnostics: ParseCompilerDiagnostics(_diagnosticsOutput),
+	}
+	AttachDiagnostics(&resp)
+	for i, want := range [][]int{{2}, nil, {2}} {
+		if !reflect.DeepEqual(resp.Steps[i].Diagnostics, want) {
+			t.Errorf("step %d: got %v, want %v", i, resp.Steps[i].Diagnostics, want)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package serialize
+
+import (
+	"cmp"
+	"fmt"
+	"html"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// DiagramFormat is the format used to render the memory state of a step as a diagram
+type DiagramFormat string
+
+const (
+	DiagramDot     DiagramFormat = "dot"
+	DiagramMermaid DiagramFormat = "mermaid"
+)
+
+// _maxDiagramValueLen is the longest value shown in a diagram cell before it gets truncated
+const _maxDiagramValueLen = 48
+
+// ParseDiagramFormat validates the given format name
+func ParseDiagramFormat(format string) (DiagramFormat, error) {
+	switch DiagramFormat(format) {
+	case DiagramDot, DiagramMermaid:
+		return DiagramFormat(format), nil
+	}
+	return "", fmt.Errorf("unknown diagram format %q", format)
+}
+
+// WriteDiagram renders the stack frames, package variables and the heap objects reachable from them
+// at the given step index (0 based) as a Graphviz or Mermaid diagram with an edge for every pointer,
+// slice and map.
+func WriteDiagram(w io.Writer, resp ExecutionResponse, stepIndex int, format DiagramFormat) error {
+	if stepIndex < 0 || stepIndex >= len(resp.Steps) {
+		return fmt.Errorf("step %d out of range, the trace has %d steps", stepIndex, len(resp.Steps))
+	}
+	d := buildDiagram(&resp.Steps[stepIndex])
+	if format == DiagramMermaid {
+		return d.writeMermaid(w)
+	}
+	return d.writeDot(w)
+}
+
+type diagramRow struct {
+	name  string
+	value string
+}
+
+type diagramNode struct {
+	id    string
+	title string
+	// cluster is the id of the group (goroutine) the node belongs to, empty for heap objects
+	cluster string
+	rows    []diagramRow
+}
+
+type diagramEdge struct {
+	from string
+	row  int
+	to   string
+}
+
+type diagram struct {
+	clusters []string
+	nodes    []*diagramNode
+	edges    []diagramEdge
+	objects  map[string]bool
+}
+
+func buildDiagram(step *Step) *diagram {
+	d := &diagram{objects: map[string]bool{}}
+	if len(step.PackageVariables) > 0 {
+		globals := d.addNode("globals", "package variables", "")
+		d.addVariables(globals, step.PackageVariables)
+	}
+	for _, data := range step.GoroutinesData {
+		if data.Goroutine == nil {
+			continue
+		}
+		cluster := fmt.Sprintf("goroutine %d", data.Goroutine.ID)
+		for i, frame := range data.Stacktrace {
+			if !isInMainDotGo(frame.File) {
+				continue
+			}
+			if len(d.clusters) == 0 || d.clusters[len(d.clusters)-1] != cluster {
+				d.clusters = append(d.clusters, cluster)
+			}
+			title := fmt.Sprintf("%s() line %d", shortFunctionName(frame.Function), frame.Line)
+			node := d.addNode(fmt.Sprintf("g%d_f%d", data.Goroutine.ID, i), title, cluster)
+			d.addVariables(node, frame.Arguments)
+			d.addVariables(node, frame.Locals)
+		}
+	}
+	return d
+}
+
+func (d *diagram) addNode(id, title, cluster string) *diagramNode {
+	node := &diagramNode{id: id, title: title, cluster: cluster}
+	d.nodes = append(d.nodes, node)
+	return node
+}
+
+func (d *diagram) addVariables(node *diagramNode, vars []api.Variable) {
+	for _, variable := range vars {
+		node.rows = append(node.rows, diagramRow{name: variable.Name, value: diagramValue(&variable)})
+		d.link(node, len(node.rows)-1, &variable)
+	}
+}
+
+// link adds an edge from the given row to the memory the variable points to
+func (d *diagram) link(node *diagramNode, row int, variable *api.Variable) {
+	var target string
+	switch reflect.Kind(variable.Kind) {
+	case reflect.Pointer:
+		if len(variable.Children) == 0 || variable.Children[0].Addr == 0 {
+			return
+		}
+		target = d.addObject(&variable.Children[0])
+	case reflect.Slice:
+		if variable.Base == 0 || variable.Len == 0 {
+			return
+		}
+		target = d.addArray(variable)
+	case reflect.Map:
+		if variable.Len == 0 || len(variable.Children) == 0 {
+			return
+		}
+		target = d.addMap(variable)
+	case reflect.Interface:
+		// the row links to what the dynamic value points to
+		if len(variable.Children) > 0 {
+			d.link(node, row, &variable.Children[0])
+		}
+		return
+	default:
+		return
+	}
+	d.edges = append(d.edges, diagramEdge{from: node.id, row: row, to: target})
+}
+
+func (d *diagram) addObject(variable *api.Variable) string {
+	id := fmt.Sprintf("obj_%x", variable.Addr)
+	if d.objects[id] {
+		return id
+	}
+	d.objects[id] = true
+	node := d.addNode(id, variable.Type, "")
+	if reflect.Kind(variable.Kind) == reflect.Struct {
+		d.addVariables(node, variable.Children)
+	} else {
+		node.rows = append(node.rows, diagramRow{value: diagramValue(variable)})
+		d.link(node, 0, variable)
+	}
+	return id
+}
+
+func (d *diagram) addArray(slice *api.Variable) string {
+	id := fmt.Sprintf("arr_%x", slice.Base)
+	if d.objects[id] {
+		return id
+	}
+	d.objects[id] = true
+	node := d.addNode(id, fmt.Sprintf("[%d]%s", slice.Cap, strings.TrimPrefix(slice.Type, "[]")), "")
+	for i, element := range slice.Children {
+		node.rows = append(node.rows, diagramRow{name: fmt.Sprintf("[%d]", i), value: diagramValue(&element)})
+		d.link(node, len(node.rows)-1, &element)
+	}
+	if int64(len(slice.Children)) < slice.Len {
+		node.rows = append(node.rows, diagramRow{value: fmt.Sprintf("... +%d more", slice.Len-int64(len(slice.Children)))})
+	}
+	return id
+}
+
+// addMap adds the entries of the map, the keys and the values are interleaved in its children
+func (d *diagram) addMap(m *api.Variable) string {
+	id := fmt.Sprintf("map_%x", cmp.Or(m.Base, m.Addr))
+	if d.objects[id] {
+		return id
+	}
+	d.objects[id] = true
+	node := d.addNode(id, m.Type, "")
+	for i := 0; i+1 < len(m.Children); i += 2 {
+		value := &m.Children[i+1]
+		node.rows = append(node.rows, diagramRow{name: diagramValue(&m.Children[i]), value: diagramValue(value)})
+		d.link(node, len(node.rows)-1, value)
+	}
+	if loaded := int64(len(m.Children) / 2); loaded < m.Len {
+		node.rows = append(node.rows, diagramRow{value: fmt.Sprintf("... +%d more", m.Len-loaded)})
+	}
+	return id
+}
+
+func diagramValue(variable *api.Variable) string {
+	switch reflect.Kind(variable.Kind) {
+	case reflect.Pointer:
+		if len(variable.Children) == 0 || variable.Children[0].Addr == 0 {
+			return "nil"
+		}
+		return "→"
+	case reflect.Slice:
+		return fmt.Sprintf("len: %d, cap: %d", variable.Len, variable.Cap)
+	case reflect.Map:
+		if len(variable.Children) == 0 {
+			break
+		}
+		return fmt.Sprintf("len: %d", variable.Len)
+	case reflect.Interface:
+		// shown like the dynamic value, which link follows
+		if len(variable.Children) > 0 && variable.Children[0].Kind != reflect.Invalid {
+			return diagramValue(&variable.Children[0])
+		}
+	}
+	value := []rune(variable.SinglelineString())
+	if len(value) > _maxDiagramValueLen {
+		return string(value[:_maxDiagramValueLen]) + "..."
+	}
+	return string(value)
+}
+
+func (d *diagram) writeDot(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph step {\n\trankdir=LR;\n\tnode [shape=plaintext];\n")
+	writeNode := func(node *diagramNode, indent string) {
+		fmt.Fprintf(&b, "%s%s [label=<<table border=\"0\" cellborder=\"1\" cellspacing=\"0\">", indent, node.id)
+		fmt.Fprintf(&b, "<tr><td colspan=\"2\"><b>%s</b></td></tr>", html.EscapeString(node.title))
+		for i, row := range node.rows {
+			fmt.Fprintf(&b, "<tr><td>%s</td><td port=\"r%d\">%s</td></tr>", html.EscapeString(row.name), i, html.EscapeString(row.value))
+		}
+		b.WriteString("</table>>];\n")
+	}
+	for _, node := range d.nodes {
+		if node.cluster == "" {
+			writeNode(node, "\t")
+		}
+	}
+	for i, cluster := range d.clusters {
+		fmt.Fprintf(&b, "\tsubgraph cluster_%d {\n\t\tlabel=%q;\n", i, cluster)
+		for _, node := range d.nodes {
+			if node.cluster == cluster {
+				writeNode(node, "\t\t")
+			}
+		}
+		b.WriteString("\t}\n")
+	}
+	for _, edge := range d.edges {
+		fmt.Fprintf(&b, "\t%s:r%d -> %s;\n", edge.from, edge.row, edge.to)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeMermaid renders the diagram as a mermaid flowchart, since mermaid nodes have no ports
+// every variable of a frame gets its own node so pointer edges start from the variable
+func (d *diagram) writeMermaid(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	rowID := func(node *diagramNode, row int) string {
+		if node.cluster == "" {
+			return node.id
+		}
+		return fmt.Sprintf("%s_r%d", node.id, row)
+	}
+	nodes := map[string]*diagramNode{}
+	for _, node := range d.nodes {
+		nodes[node.id] = node
+		if node.cluster != "" {
+			continue
+		}
+		lines := []string{mermaidEscape(node.title)}
+		for _, row := range node.rows {
+			line := row.value
+			if row.name != "" {
+				line = row.name + " = " + row.value
+			}
+			lines = append(lines, mermaidEscape(line))
+		}
+		fmt.Fprintf(&b, "\t%s[\"%s\"]\n", node.id, strings.Join(lines, "<br/>"))
+	}
+	for i, cluster := range d.clusters {
+		fmt.Fprintf(&b, "\tsubgraph cluster_%d [\"%s\"]\n", i, cluster)
+		for _, node := range d.nodes {
+			if node.cluster != cluster {
+				continue
+			}
+			fmt.Fprintf(&b, "\t\tsubgraph %s [\"%s\"]\n", node.id, mermaidEscape(node.title))
+			for j, row := range node.rows {
+				fmt.Fprintf(&b, "\t\t\t%s[\"%s = %s\"]\n", rowID(node, j), mermaidEscape(row.name), mermaidEscape(row.value))
+			}
+			b.WriteString("\t\tend\n")
+		}
+		b.WriteString("\tend\n")
+	}
+	for _, edge := range d.edges {
+		from := nodes[edge.from]
+		if from.cluster == "" && from.rows[edge.row].name != "" {
+			fmt.Fprintf(&b, "\t%s -- \"%s\" --> %s\n", from.id, mermaidEscape(from.rows[edge.row].name), edge.to)
+			continue
+		}
+		fmt.Fprintf(&b, "\t%s --> %s\n", rowID(from, edge.row), edge.to)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(s)
+}
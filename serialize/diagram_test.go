@@ -0,0 +1,94 @@
+package serialize
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+var _updateGolden = flag.Bool("update", false, "update the golden files of the tests")
+
+// newDiagramStep builds a step with a linked list shared by a pointer, an interface and a map, a slice and
+// a string holding quotes and angle brackets
+func newDiagramStep() Step {
+	node := func(addr uint64, value string, next *api.Variable) api.Variable {
+		nextPointer := api.Variable{Name: "next", Type: "*main.node", Kind: reflect.Pointer, Children: []api.Variable{{Type: "main.node", Kind: reflect.Struct}}}
+		if next != nil {
+			nextPointer.Children = []api.Variable{*next}
+		}
+		return api.Variable{Type: "main.node", Kind: reflect.Struct, Addr: addr, Len: 2, Children: []api.Variable{
+			{Name: "value", Type: "int", Kind: reflect.Int, Value: value},
+			nextPointer,
+		}}
+	}
+	second := node(0xc000012020, "2", nil)
+	first := node(0xc000012010, "1", &second)
+	pointer := func(name string, to api.Variable) api.Variable {
+		return api.Variable{Name: name, Type: "*main.node", Kind: reflect.Pointer, Children: []api.Variable{to}}
+	}
+	str := func(name, value string) api.Variable {
+		return api.Variable{Name: name, Type: "string", Kind: reflect.String, Value: value, Len: int64(len(value))}
+	}
+	element := func(value string) api.Variable {
+		return api.Variable{Type: "int", Kind: reflect.Int, Value: value}
+	}
+	nilNode := api.Variable{Type: "*main.node", Kind: reflect.Pointer, Children: []api.Variable{{Type: "main.node", Kind: reflect.Struct}}}
+
+	main := api.Location{File: "/tmp/main.go", Line: 24, Function: &api.Function{Name_: "main.main"}}
+	push := api.Location{File: "/tmp/main.go", Line: 15, Function: &api.Function{Name_: "main.(*list).push"}}
+	return Step{
+		PackageVariables: []api.Variable{str("main.greeting", `say "hi" <now>`)},
+		GoroutinesData: []GoRoutineData{{
+			Goroutine: &api.Goroutine{ID: 1, CurrentLoc: push},
+			Stacktrace: []api.Stackframe{
+				{Location: push, Arguments: []api.Variable{pointer("n", first)}},
+				{Location: main, Locals: []api.Variable{
+					pointer("head", first),
+					{Name: "current", Type: "any", Kind: reflect.Interface, Children: []api.Variable{pointer("data", first)}},
+					{Name: "xs", Type: "[]int", Kind: reflect.Slice, Base: 0xc000014000, Len: 3, Cap: 4, Children: []api.Variable{element("1"), element("2"), element("3")}},
+					{Name: "byName", Type: "map[string]*main.node", Kind: reflect.Map, Addr: 0xc000016000, Len: 3, Children: []api.Variable{
+						str("", "first"), pointer("", first),
+						str("", `"quoted"`), nilNode,
+					}},
+				}},
+			},
+		}},
+	}
+}
+
+func TestWriteDiagram(t *testing.T) {
+	resp := ExecutionResponse{Steps: []Step{newDiagramStep()}}
+	for _, format := range []DiagramFormat{DiagramDot, DiagramMermaid} {
+		t.Run(string(format), func(t *testing.T) {
+			var out strings.Builder
+			if err := WriteDiagram(&out, resp, 0, format); err != nil {
+				t.Fatalf("WriteDiagram: %v", err)
+			}
+			golden := filepath.Join("testdata", "diagram."+string(format))
+			if *_updateGolden {
+				if err := os.WriteFile(golden, []byte(out.String()), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != string(want) {
+				t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+			}
+		})
+	}
+}
+
+func TestWriteDiagramStepOutOfRange(t *testing.T) {
+	resp := ExecutionResponse{Steps: []Step{newDiagramStep()}}
+	if err := WriteDiagram(&strings.Builder{}, resp, 1, DiagramDot); err == nil {
+		t.Error("expected an error for a step out of range")
+	}
+}
@@ -0,0 +1,224 @@
+package serialize
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// TraceDiff describes how the execution of two traces differs
+type TraceDiff struct {
+	// Aligned holds the pairs of steps that executed the same source location with the same call structure
+	Aligned []AlignedSteps `json:"aligned"`
+	// FirstDivergence is where the control flow of the two traces first differs, nil if it never does
+	FirstDivergence *Divergence `json:"firstDivergence,omitempty"`
+	// ValueDiffs lists the variables whose values differ at aligned steps, once per variable
+	ValueDiffs []ValueDiff `json:"valueDiffs,omitempty"`
+	// OutputDiffs lists the first differing line of stdout and stderr
+	OutputDiffs []OutputDiff `json:"outputDiffs,omitempty"`
+}
+
+// AlignedSteps is a pair of step indexes, one from each trace
+type AlignedSteps struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+// Divergence is the first pair of steps that doesn't line up in the two traces,
+// an index equal to the trace length means the trace ended
+type Divergence struct {
+	StepA     int    `json:"stepA"`
+	StepB     int    `json:"stepB"`
+	LocationA string `json:"locationA"`
+	LocationB string `json:"locationB"`
+}
+
+// ValueDiff is a variable that has different values at aligned steps
+type ValueDiff struct {
+	StepA    int    `json:"stepA"`
+	StepB    int    `json:"stepB"`
+	Function string `json:"function"`
+	Variable string `json:"variable"`
+	ValueA   string `json:"valueA"`
+	ValueB   string `json:"valueB"`
+	// Occurrences is the number of aligned steps where the variable differs
+	Occurrences int `json:"occurrences"`
+}
+
+const (
+	// _noNewlineAtEnd follows the last line of an output in an OutputDiff when the output doesn't end with a newline
+	_noNewlineAtEnd = "(no newline at end)"
+	// _endOfOutput is the line of an OutputDiff for the output that has fewer lines
+	_endOfOutput = "(end of output)"
+)
+
+// OutputDiff is the first line that differs in the given output stream, A and B are the lines without
+// their newline, see _noNewlineAtEnd and _endOfOutput
+type OutputDiff struct {
+	Stream string `json:"stream"`
+	Line   int    `json:"line"`
+	A      string `json:"a"`
+	B      string `json:"b"`
+}
+
+// DiffTraces aligns two traces by source location and call structure and reports where they diverge,
+// which variables differ at aligned steps and how their outputs differ
+func DiffTraces(a, b ExecutionResponse) TraceDiff {
+	keysA := make([]string, len(a.Steps))
+	for i := range a.Steps {
+		keysA[i] = callPathKey(&a.Steps[i])
+	}
+	keysB := make([]string, len(b.Steps))
+	for i := range b.Steps {
+		keysB[i] = callPathKey(&b.Steps[i])
+	}
+
+	diff := TraceDiff{Aligned: alignKeys(keysA, keysB)}
+	diff.FirstDivergence = firstDivergence(diff.Aligned, keysA, keysB)
+
+	valueDiffs := map[string]int{}
+	for _, pair := range diff.Aligned {
+		for _, valueDiff := range diffStepValues(&a.Steps[pair.A], &b.Steps[pair.B]) {
+			id := valueDiff.Function + "." + valueDiff.Variable
+			if index, ok := valueDiffs[id]; ok {
+				diff.ValueDiffs[index].Occurrences++
+				continue
+			}
+			valueDiff.StepA, valueDiff.StepB = pair.A, pair.B
+			valueDiffs[id] = len(diff.ValueDiffs)
+			diff.ValueDiffs = append(diff.ValueDiffs, valueDiff)
+		}
+	}
+
+	if outputDiff, ok := diffOutput("stdout", a.StdOut, b.StdOut); ok {
+		diff.OutputDiffs = append(diff.OutputDiffs, outputDiff)
+	}
+	if outputDiff, ok := diffOutput("stderr", a.StdErr, b.StdErr); ok {
+		diff.OutputDiffs = append(diff.OutputDiffs, outputDiff)
+	}
+	return diff
+}
+
+// alignKeys returns the longest common subsequence of the two key lists as index pairs
+func alignKeys(a, b []string) []AlignedSteps {
+	// lengths[i][j] is the LCS length of a[i:] and b[j:]
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+	var aligned []AlignedSteps
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			aligned = append(aligned, AlignedSteps{A: i, B: j})
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return aligned
+}
+
+func firstDivergence(aligned []AlignedSteps, keysA, keysB []string) *Divergence {
+	next := AlignedSteps{}
+	for _, pair := range aligned {
+		if pair != next {
+			break
+		}
+		next = AlignedSteps{A: pair.A + 1, B: pair.B + 1}
+	}
+	if next.A == len(keysA) && next.B == len(keysB) {
+		return nil
+	}
+	divergence := &Divergence{StepA: next.A, StepB: next.B, LocationA: "end of trace", LocationB: "end of trace"}
+	if next.A < len(keysA) {
+		divergence.LocationA = keysA[next.A]
+	}
+	if next.B < len(keysB) {
+		divergence.LocationB = keysB[next.B]
+	}
+	return divergence
+}
+
+func diffStepValues(a, b *Step) []ValueDiff {
+	var diffs []ValueDiff
+	diffs = appendValueDiffs(diffs, "package", a.PackageVariables, b.PackageVariables)
+	frameA, frameB := a.GoroutinesData[0].Stacktrace, b.GoroutinesData[0].Stacktrace
+	if len(frameA) == 0 || len(frameB) == 0 {
+		return diffs
+	}
+	function := shortFunctionName(frameA[0].Function)
+	diffs = appendValueDiffs(diffs, function, frameA[0].Arguments, frameB[0].Arguments)
+	diffs = appendValueDiffs(diffs, function, frameA[0].Locals, frameB[0].Locals)
+	return diffs
+}
+
+// appendValueDiffs compares variables with the same name, variables that exist in only one of the traces are skipped
+func appendValueDiffs(diffs []ValueDiff, function string, a, b []api.Variable) []ValueDiff {
+	values := make(map[string]string, len(b))
+	for _, variable := range b {
+		values[variable.Name] = variable.SinglelineString()
+	}
+	for _, variable := range a {
+		valueB, ok := values[variable.Name]
+		if !ok {
+			continue
+		}
+		valueA := variable.SinglelineString()
+		if valueA != valueB {
+			diffs = append(diffs, ValueDiff{Function: function, Variable: variable.Name, ValueA: valueA, ValueB: valueB, Occurrences: 1})
+		}
+	}
+	return diffs
+}
+
+func diffOutput(stream, a, b string) (OutputDiff, bool) {
+	if a == b {
+		return OutputDiff{}, false
+	}
+	linesA, linesB := slices.Collect(strings.Lines(a)), slices.Collect(strings.Lines(b))
+	for i := 0; ; i++ {
+		if i >= len(linesA) || i >= len(linesB) || linesA[i] != linesB[i] {
+			return OutputDiff{Stream: stream, Line: i + 1, A: outputLine(linesA, i), B: outputLine(linesB, i)}, true
+		}
+	}
+}
+
+// outputLine returns the line of an output without its newline, marking the last line when
+// it has none and the lines past the end of the output
+func outputLine(lines []string, i int) string {
+	if i >= len(lines) {
+		return _endOfOutput
+	}
+	line, ok := strings.CutSuffix(lines[i], "\n")
+	if !ok {
+		return line + " " + _noNewlineAtEnd
+	}
+	return line
+}
+
+// callPathKey identifies a step by the chain of user functions on the stack and the current line
+func callPathKey(step *Step) string {
+	data := step.GoroutinesData[0]
+	var functions []string
+	for i := len(data.Stacktrace) - 1; i >= 0; i-- {
+		if isInMainDotGo(data.Stacktrace[i].File) {
+			functions = append(functions, shortFunctionName(data.Stacktrace[i].Function))
+		}
+	}
+	return fmt.Sprintf("%s:%d", strings.Join(functions, ">"), data.Goroutine.CurrentLoc.Line)
+}
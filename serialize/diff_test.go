@@ -0,0 +1,76 @@
+package serialize
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffTraces(t *testing.T) {
+	a := ExecutionResponse{
+		StdOut: "sum\n10\n",
+		Steps: []Step{
+			newTestStep(1, "main.main", 6),
+			newTestStep(1, "main.main", 7, intVar("sum", "0")),
+			newTestStep(1, "main.main", 8, intVar("sum", "4")),
+			newTestStep(1, "main.main", 10, intVar("sum", "10")),
+		},
+	}
+	b := ExecutionResponse{
+		StdOut: "sum\n12\n",
+		Steps: []Step{
+			newTestStep(1, "main.main", 6),
+			newTestStep(1, "main.main", 7, intVar("sum", "0")),
+			newTestStep(1, "main.main", 9, intVar("sum", "2")),
+			newTestStep(1, "main.main", 10, intVar("sum", "12")),
+		},
+	}
+
+	diff := DiffTraces(a, b)
+
+	wantAligned := []AlignedSteps{{A: 0, B: 0}, {A: 1, B: 1}, {A: 3, B: 3}}
+	if !reflect.DeepEqual(diff.Aligned, wantAligned) {
+		t.Errorf("aligned: got %v, want %v", diff.Aligned, wantAligned)
+	}
+	wantDivergence := &Divergence{StepA: 2, StepB: 2, LocationA: "main:8", LocationB: "main:9"}
+	if !reflect.DeepEqual(diff.FirstDivergence, wantDivergence) {
+		t.Errorf("divergence: got %+v, want %+v", diff.FirstDivergence, wantDivergence)
+	}
+	wantValues := []ValueDiff{{StepA: 3, StepB: 3, Function: "main", Variable: "sum", ValueA: "10", ValueB: "12", Occurrences: 1}}
+	if !reflect.DeepEqual(diff.ValueDiffs, wantValues) {
+		t.Errorf("value diffs: got %+v, want %+v", diff.ValueDiffs, wantValues)
+	}
+	wantOutput := []OutputDiff{{Stream: "stdout", Line: 2, A: "10", B: "12"}}
+	if !reflect.DeepEqual(diff.OutputDiffs, wantOutput) {
+		t.Errorf("output diffs: got %+v, want %+v", diff.OutputDiffs, wantOutput)
+	}
+}
+
+func TestDiffTracesIdentical(t *testing.T) {
+	a := ExecutionResponse{Steps: []Step{newTestStep(1, "main.main", 6), newTestStep(1, "main.main", 7)}}
+
+	diff := DiffTraces(a, a)
+
+	if diff.FirstDivergence != nil {
+		t.Errorf("expected no divergence, got %+v", diff.FirstDivergence)
+	}
+	if len(diff.ValueDiffs) != 0 || len(diff.OutputDiffs) != 0 {
+		t.Errorf("expected no differences, got %+v", diff)
+	}
+}
+
+func TestDiffOutputTrailingNewline(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want OutputDiff
+	}{
+		{"sum\n10\n", "sum\n10", OutputDiff{Stream: "stdout", Line: 2, A: "10", B: "10 (no newline at end)"}},
+		{"sum\n", "sum\n10\n", OutputDiff{Stream: "stdout", Line: 2, A: "(end of output)", B: "10"}},
+		{"sum\n\n", "sum\n", OutputDiff{Stream: "stdout", Line: 2, A: "", B: "(end of output)"}},
+	}
+	for _, tt := range tests {
+		got, ok := diffOutput("stdout", tt.a, tt.b)
+		if !ok || got != tt.want {
+			t.Errorf("diffOutput(%q, %q): got %+v, %t, want %+v", tt.a, tt.b, got, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package serialize
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// Instruction is a machine instruction of a disassembled function
+type Instruction struct {
+	PC   uint64 `json:"pc"`
+	Line int    `json:"line"`
+	// Text is the instruction in the Go assembler syntax
+	Text string `json:"text"`
+	// Call is the function called by CALL instructions
+	Call string `json:"call,omitempty"`
+}
+
+// AssemblyRef points a step to the instructions of its line in ExecutionResponse.Disassembly
+type AssemblyRef struct {
+	Function string `json:"function"`
+	// PC is the address of the next instruction to run
+	PC uint64 `json:"pc"`
+	// Start and End are the indexes of the first and after the last instruction of the line's block holding PC
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// attachAssembly references from the step the instructions of the line the current goroutine is at in main.go,
+// the functions are disassembled once and kept in v.disassembly
+func (v *Serializer) attachAssembly(ctx context.Context, step *Step) error {
+	loc := step.GoroutinesData[0].Goroutine.CurrentLoc
+	if !isInMainDotGo(loc.File) || loc.Function == nil {
+		return nil
+	}
+	function := loc.Function.Name()
+	instructions, ok := v.disassembly[function]
+	if !ok {
+		asm, err := v.client.Disassemble(ctx, api.EvalScope{GoroutineID: -1}, loc.PC, 0, api.GoFlavour)
+		if err != nil {
+			return fmt.Errorf("disassemble %s: %w", function, err)
+		}
+		instructions = make([]Instruction, 0, len(asm))
+		for _, instruction := range asm {
+			converted := Instruction{PC: instruction.Loc.PC, Line: instruction.Loc.Line, Text: instruction.Text}
+			if instruction.DestLoc != nil && instruction.DestLoc.Function != nil {
+				converted.Call = instruction.DestLoc.Function.Name()
+			}
+			instructions = append(instructions, converted)
+		}
+		v.disassembly[function] = instructions
+	}
+	step.Assembly = lineInstructions(function, instructions, loc.PC, loc.Line)
+	return nil
+}
+
+// lineInstructions returns the reference to the contiguous instructions of the line around pc, nil if pc isn't in the function
+func lineInstructions(function string, instructions []Instruction, pc uint64, line int) *AssemblyRef {
+	at := -1
+	for i := range instructions {
+		if instructions[i].PC == pc {
+			at = i
+			break
+		}
+	}
+	if at == -1 {
+		return nil
+	}
+	ref := &AssemblyRef{Function: function, PC: pc, Start: at, End: at + 1}
+	for ref.Start > 0 && instructions[ref.Start-1].Line == line {
+		ref.Start--
+	}
+	for ref.End < len(instructions) && instructions[ref.End].Line == line {
+		ref.End++
+	}
+	return ref
+}
@@ -0,0 +1,19 @@
+package serialize
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLineInstructions(t *testing.T) {
+	instructions := []Instruction{
+		{PC: 0x10, Line: 5}, {PC: 0x14, Line: 6}, {PC: 0x18, Line: 6}, {PC: 0x1c, Line: 6}, {PC: 0x20, Line: 7}, {PC: 0x24, Line: 6},
+	}
+	want := &AssemblyRef{Function: "main.main", PC: 0x18, Start: 1, End: 4}
+	if got := lineInstructions("main.main", instructions, 0x18, 6); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got := lineInstructions("main.main", instructions, 0x30, 6); got != nil {
+		t.Errorf("got %+v for a pc outside the function", got)
+	}
+}
@@ -0,0 +1,182 @@
+package serialize
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// LoadLimits bounds how much of every variable is loaded, zero fields keep the default limit
+type LoadLimits struct {
+	MaxVariableRecurse int
+	MaxStringLen       int
+	MaxArrayValues     int
+	MaxStructFields    int
+}
+
+// DefaultLoadLimits are the limits used when none are given
+var DefaultLoadLimits = LoadLimits{
+	MaxVariableRecurse: defaultLoadConfig.MaxVariableRecurse,
+	MaxStringLen:       defaultLoadConfig.MaxStringLen,
+	MaxArrayValues:     defaultLoadConfig.MaxArrayValues,
+	MaxStructFields:    defaultLoadConfig.MaxStructFields,
+}
+
+// Capped lowers the limits above the given caps to the caps, zero limits are capped to the defaults
+func (l LoadLimits) Capped(caps LoadLimits) LoadLimits {
+	capped := func(limit, defaultLimit, limitCap int) int {
+		if limit == 0 {
+			limit = defaultLimit
+		}
+		return min(limit, limitCap)
+	}
+	return LoadLimits{
+		MaxVariableRecurse: capped(l.MaxVariableRecurse, DefaultLoadLimits.MaxVariableRecurse, caps.MaxVariableRecurse),
+		MaxStringLen:       capped(l.MaxStringLen, DefaultLoadLimits.MaxStringLen, caps.MaxStringLen),
+		MaxArrayValues:     capped(l.MaxArrayValues, DefaultLoadLimits.MaxArrayValues, caps.MaxArrayValues),
+		MaxStructFields:    capped(l.MaxStructFields, DefaultLoadLimits.MaxStructFields, caps.MaxStructFields),
+	}
+}
+
+// loadConfig returns the delve load config with the limits
+func (l LoadLimits) loadConfig() api.LoadConfig {
+	cfg := defaultLoadConfig
+	if l.MaxVariableRecurse != 0 {
+		cfg.MaxVariableRecurse = l.MaxVariableRecurse
+	}
+	if l.MaxStringLen != 0 {
+		cfg.MaxStringLen = l.MaxStringLen
+	}
+	if l.MaxArrayValues != 0 {
+		cfg.MaxArrayValues = l.MaxArrayValues
+	}
+	if l.MaxStructFields != 0 {
+		cfg.MaxStructFields = l.MaxStructFields
+	}
+	return cfg
+}
+
+// TruncatedVariable is a variable that was not loaded in full because of the load limits
+type TruncatedVariable struct {
+	// Step is the index of the step in the trace as recorded, before loops are collapsed, as ExpandRequest expects it
+	Step int `json:"step"`
+	VariableFrame
+	// Name is the path to the variable from the one holding it, e.g. "t.left" or "xs[2]", it can be evaluated in the frame
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Address and Expression locate the variable in memory, Expression loads it in a live debugging session
+	Address    uint64 `json:"address"`
+	Expression string `json:"expression"`
+	// Loaded is how many elements, fields or bytes were loaded out of Len
+	Loaded int64 `json:"loaded"`
+	Len    int64 `json:"len"`
+}
+
+// AnnotateTruncated sets Truncated on every step to the variables reachable from the variables of the frames
+// compared by AnnotateChanges and from the package variables that were cut off by the load limits.
+// It's meant for the trace as recorded as the steps keep their indexes in it.
+func AnnotateTruncated(steps []Step) {
+	for i := range steps {
+		step := &steps[i]
+		step.Truncated = nil
+		forEachFrame(step, func(at variableFrame, vars []api.Variable) {
+			for j := range vars {
+				walkVariables(&vars[j], vars[j].Name, func(name string, variable *api.Variable) {
+					loaded, length, truncated := isTruncated(variable)
+					if !truncated || variable.Addr == 0 || variable.Flags&api.VariableFakeAddress != 0 {
+						return
+					}
+					step.Truncated = append(step.Truncated, TruncatedVariable{
+						Step:          i,
+						VariableFrame: at.VariableFrame,
+						Name:          name,
+						Type:          variable.Type,
+						Address:       variable.Addr,
+						Expression:    fmt.Sprintf("*(*%s)(%#x)", variable.Type, variable.Addr),
+						Loaded:        loaded,
+						Len:           length,
+					})
+				})
+			}
+		})
+	}
+}
+
+// isTruncated checks if the variable was cut off by the load limits, it returns how much of it was loaded
+func isTruncated(variable *api.Variable) (int64, int64, bool) {
+	if variable.Unreadable != "" {
+		return 0, 0, false
+	}
+	switch reflect.Kind(variable.Kind) {
+	case reflect.String:
+		loaded := int64(len(variable.Value))
+		return loaded, variable.Len, loaded < variable.Len
+	case reflect.Slice, reflect.Array, reflect.Struct:
+		loaded := int64(len(variable.Children))
+		return loaded, variable.Len, loaded < variable.Len
+	case reflect.Map:
+		// the keys and the values are interleaved in the children
+		loaded := int64(len(variable.Children) / 2)
+		return loaded, variable.Len, loaded < variable.Len
+	}
+	return 0, 0, false
+}
+
+// ExpandRequest asks for a variable of a step of a re-run of the traced program to be loaded again,
+// usually with higher load limits, as listed by TruncatedVariable
+type ExpandRequest struct {
+	// Step is the index of the step in the trace as recorded
+	Step      int
+	Goroutine int64
+	Frame     int
+	// Expression is evaluated in the frame, e.g. the Name of a TruncatedVariable
+	Expression string
+}
+
+// ExpandVariable runs the program up to the requested step, stepping with recordSteps like ExecutionSteps does,
+// and evaluates the expression there with the serializer's load limits
+func (v *Serializer) ExpandVariable(ctx context.Context, limit int, req ExpandRequest) (*api.Variable, error) {
+	debugState, err := v.start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if debugState.Exited {
+		return nil, fmt.Errorf("step %d not reached: the program exited", req.Step)
+	}
+
+	loops, err := v.loopCounter(debugState)
+	if err != nil {
+		return nil, fmt.Errorf("collapse loops: %w", err)
+	}
+
+	var variable *api.Variable
+	recorded := 0
+	_, err = recordSteps(ctx, limit, v.nextStop(debugState.SelectedGoroutine), loops, func(index int, _ *Step) (bool, error) {
+		recorded = index + 1
+		if index < req.Step {
+			return false, nil
+		}
+		scope := api.EvalScope{GoroutineID: req.Goroutine, Frame: req.Frame}
+		if req.Goroutine == 0 {
+			// package variables are evaluated in the current goroutine
+			scope.GoroutineID = -1
+		}
+		variable, err = v.client.EvalVariable(ctx, scope, req.Expression, v.loadConfig)
+		if err != nil {
+			return true, fmt.Errorf("eval %s: %w", req.Expression, err)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if variable != nil {
+		return variable, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("step %d not reached: the program stopped after %d steps", req.Step, recorded)
+}
@@ -0,0 +1,123 @@
+package serialize
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+func TestAnnotateTruncated(t *testing.T) {
+	long := intSliceVar("s", 0x1000, 20, 20)
+	long.Addr = 0xc000010000
+	for range 10 {
+		long.Children = append(long.Children, intVar("", "0"))
+	}
+	short := intSliceVar("t", 0x2000, 2, 2)
+	short.Addr = 0xc000010018
+	short.Children = []api.Variable{intVar("", "1"), intVar("", "2")}
+	msg := api.Variable{Name: "msg", Type: "string", Kind: 24, Addr: 0xc000010030, Len: 70, Value: "abcd"}
+
+	steps := []Step{newTestStep(1, "main.main", 9), newTestStep(1, "main.main", 10, long, short, msg)}
+	AnnotateTruncated(steps)
+
+	if steps[0].Truncated != nil {
+		t.Errorf("got truncated variables without variables: %+v", steps[0].Truncated)
+	}
+	main := VariableFrame{Goroutine: 1, Function: "main.main"}
+	want := []TruncatedVariable{
+		{Step: 1, VariableFrame: main, Name: "s", Type: "[]int", Address: 0xc000010000, Expression: "*(*[]int)(0xc000010000)", Loaded: 10, Len: 20},
+		{Step: 1, VariableFrame: main, Name: "msg", Type: "string", Address: 0xc000010030, Expression: "*(*string)(0xc000010030)", Loaded: 4, Len: 70},
+	}
+	if !reflect.DeepEqual(steps[1].Truncated, want) {
+		t.Errorf("got %+v, want %+v", steps[1].Truncated, want)
+	}
+}
+
+func TestLoadLimitsCapped(t *testing.T) {
+	caps := LoadLimits{MaxVariableRecurse: 5, MaxStringLen: 1024, MaxArrayValues: 100, MaxStructFields: 50}
+	got := LoadLimits{MaxVariableRecurse: 10, MaxArrayValues: 30}.Capped(caps)
+	want := LoadLimits{MaxVariableRecurse: 5, MaxStringLen: 64, MaxArrayValues: 30, MaxStructFields: 10}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+// stop is a stop of the program fed to recordSteps
+type stop struct {
+	step         Step
+	atMainReturn bool
+}
+
+// replayStops returns a nextStop going through the stops, the program exits after the last one
+func replayStops(stops []stop) nextStop {
+	i := 0
+	return func(context.Context) (Step, bool, bool, error) {
+		s := stops[i]
+		i++
+		return s.step, s.atMainReturn, i == len(stops), nil
+	}
+}
+
+func TestRecordStepsExpandMatchesTrace(t *testing.T) {
+	stops := []stop{
+		{step: newTestStep(1, "main.main", 5)},
+		// a stop outside of the recorded code isn't a step
+		{},
+		{step: newTestStep(1, "main.work", 12)},
+		{step: newTestStep(6, "main.worker", 20)},
+		{step: newTestStep(1, "main.main", 8), atMainReturn: true},
+		// stepping at the return of main.main stops at the same line again
+		{step: newTestStep(1, "main.main", 8), atMainReturn: true},
+		{step: newTestStep(6, "main.worker", 21)},
+	}
+
+	var trace []Step
+	reachedLimit, err := recordSteps(context.Background(), 100, replayStops(stops), nil, func(_ int, step *Step) (bool, error) {
+		trace = append(trace, *step)
+		return false, nil
+	})
+	if err != nil || reachedLimit {
+		t.Fatalf("got reached limit %t, error %v", reachedLimit, err)
+	}
+	if len(trace) != 5 {
+		t.Fatalf("got %d steps, want 5", len(trace))
+	}
+
+	for n := range trace {
+		var expanded *Step
+		_, err := recordSteps(context.Background(), 100, replayStops(stops), nil, func(index int, step *Step) (bool, error) {
+			if index < n {
+				return false, nil
+			}
+			expanded = step
+			return true, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expanded == nil || !reflect.DeepEqual(*expanded, trace[n]) {
+			t.Errorf("step %d: got %+v, want %+v", n, expanded, trace[n])
+		}
+	}
+}
+
+func TestRecordStepsLimit(t *testing.T) {
+	stops := []stop{
+		{step: newTestStep(1, "main.main", 5)},
+		{step: newTestStep(1, "main.main", 6)},
+		{step: newTestStep(1, "main.main", 7)},
+	}
+	recorded := 0
+	reachedLimit, err := recordSteps(context.Background(), 3, replayStops(stops), nil, func(int, *Step) (bool, error) {
+		recorded++
+		return false, nil
+	})
+	if err != nil || !reachedLimit {
+		t.Fatalf("got reached limit %t, error %v", reachedLimit, err)
+	}
+	if recorded != 2 {
+		t.Errorf("got %d steps recorded, want 2", recorded)
+	}
+}
@@ -0,0 +1,78 @@
+package serialize
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"time"
+)
+
+// _faketimeEpoch is the time, in nanoseconds since 1970, the clock of a faketime program starts at
+const _faketimeEpoch = 1257894000000000000
+
+// _playbackMagic starts the header the faketime runtime writes before every write to stdout and stderr:
+// 0 0 P B <8-byte time> <4-byte data length>, big endian
+var _playbackMagic = []byte{0, 0, 'P', 'B'}
+
+const _playbackHeaderLen = 4 + 8 + 4
+
+// playbackDecoder strips the playback headers from the output of a program built with -tags=faketime,
+// the output can be fed in chunks that split the headers or the data they describe
+type playbackDecoder struct {
+	// pending holds the start of a header that wasn't complete in the last chunk
+	pending []byte
+	// remaining is the length of the data of the last header that wasn't read yet
+	remaining int
+}
+
+// decode returns the output written in the chunk without the headers
+func (d *playbackDecoder) decode(chunk []byte) []byte {
+	data := append(d.pending, chunk...)
+	d.pending = nil
+	var out []byte
+	for len(data) > 0 {
+		if d.remaining > 0 {
+			n := min(d.remaining, len(data))
+			out = append(out, data[:n]...)
+			data = data[n:]
+			d.remaining -= n
+			continue
+		}
+		if !bytes.HasPrefix(data, _playbackMagic) {
+			if len(data) < len(_playbackMagic) && bytes.HasPrefix(_playbackMagic, data) {
+				d.pending = data
+				break
+			}
+			// not written by the faketime runtime, e.g. a crash report written by the OS
+			next := bytes.Index(data, _playbackMagic)
+			if next == -1 {
+				next = len(data)
+			}
+			out = append(out, data[:next]...)
+			data = data[next:]
+			continue
+		}
+		if len(data) < _playbackHeaderLen {
+			d.pending = data
+			break
+		}
+		d.remaining = int(binary.BigEndian.Uint32(data[_playbackHeaderLen-4:]))
+		data = data[_playbackHeaderLen:]
+	}
+	return out
+}
+
+// decodePlayback strips the playback headers from the whole output
+func decodePlayback(output []byte) []byte {
+	var d playbackDecoder
+	return d.decode(output)
+}
+
+// readVirtualTime returns how far the clock of a faketime program moved since it started
+func (v *Serializer) readVirtualTime(ctx context.Context) (time.Duration, error) {
+	now, err := v.evalUint(ctx, "runtime.faketime")
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(int64(now) - _faketimeEpoch), nil
+}
@@ -0,0 +1,65 @@
+package serialize
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+)
+
+// playbackWrite prefixes the data with a playback header as the faketime runtime does
+func playbackWrite(data string) []byte {
+	header := make([]byte, _playbackHeaderLen)
+	copy(header, _playbackMagic)
+	binary.BigEndian.PutUint64(header[4:], _faketimeEpoch)
+	binary.BigEndian.PutUint32(header[12:], uint32(len(data)))
+	return append(header, data...)
+}
+
+func TestPlaybackDecoder(t *testing.T) {
+	output := append(playbackWrite("hello "), playbackWrite("world\n")...)
+	if got := string(decodePlayback(output)); got != "hello world\n" {
+		t.Errorf("got %q, want %q", got, "hello world\n")
+	}
+
+	// the steps read the output in chunks that can split the headers and the data
+	for _, split := range []int{2, 9, 20, 25} {
+		var d playbackDecoder
+		got := string(d.decode(output[:split])) + string(d.decode(output[split:]))
+		if got != "hello world\n" {
+			t.Errorf("split at %d: got %q, want %q", split, got, "hello world\n")
+		}
+	}
+}
+
+func TestAttachOutputSplitHeader(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir("output", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(_stderrPath, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output := append(playbackWrite("hello "), playbackWrite("world\n")...)
+	// the second header is cut in the middle by the first step
+	split := len(playbackWrite("hello ")) + 7
+
+	v := &Serializer{metadata: Metadata{Faketime: true}}
+	var steps [2]Step
+	for i, chunk := range [][]byte{output[:split], output[split:]} {
+		file, err := os.OpenFile(_stdoutPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = file.Write(chunk)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := v.attachOutput(&steps[i]); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+	}
+	if steps[0].StdOut != "hello " || steps[1].StdOut != "world\n" {
+		t.Errorf("got %q and %q, want %q and %q", steps[0].StdOut, steps[1].StdOut, "hello ", "world\n")
+	}
+}
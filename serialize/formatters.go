@@ -0,0 +1,356 @@
+package serialize
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math/big"
+	"path"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+const _formatDirective = "//gotutor:format "
+
+// ViewKind is the shape of a formatted value
+type ViewKind string
+
+const (
+	ViewText ViewKind = "text"
+	ViewList ViewKind = "list"
+	ViewTree ViewKind = "tree"
+)
+
+// View is a semantic view of a variable made by a Formatter, e.g. a linked list shown as the list of its values
+type View struct {
+	Kind  ViewKind  `json:"kind"`
+	Text  string    `json:"text,omitempty"`
+	Items []string  `json:"items,omitempty"`
+	Tree  *TreeNode `json:"tree,omitempty"`
+	// Truncated is set when the variable wasn't loaded deep enough for the whole view, see LoadLimits
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// TreeNode is a node of a tree view
+type TreeNode struct {
+	// Field is the field of the parent node pointing to the node, e.g. "left"
+	Field    string     `json:"field,omitempty"`
+	Value    string     `json:"value"`
+	Children []TreeNode `json:"children,omitempty"`
+}
+
+// String renders the view on a single line, lists as [a, b] and trees as value(child, child)
+func (v View) String() string {
+	var text string
+	switch v.Kind {
+	case ViewList:
+		text = "[" + strings.Join(v.Items, ", ") + "]"
+	case ViewTree:
+		if v.Tree != nil {
+			text = v.Tree.String()
+		}
+	default:
+		text = v.Text
+	}
+	if v.Truncated {
+		text += "..."
+	}
+	return text
+}
+
+func (n TreeNode) String() string {
+	if len(n.Children) == 0 {
+		return n.Value
+	}
+	children := make([]string, 0, len(n.Children))
+	for _, child := range n.Children {
+		children = append(children, child.Field+": "+child.String())
+	}
+	return n.Value + "(" + strings.Join(children, ", ") + ")"
+}
+
+// Formatter makes views of the variables of the types it matches
+type Formatter struct {
+	Name string
+	// Type is the name of the types the formatter applies to, as delve names them, e.g. "main.Node" or "math/big.Int",
+	// or a pattern as in path.Match, e.g. "main.*Node". Pointers are formatted through the values they point to.
+	Type string
+	// Format returns the view of the variable, false when it can't format it
+	Format func(variable *api.Variable) (View, bool)
+}
+
+// Formatters is a registry of formatters, the formatter registered last is tried first
+type Formatters struct {
+	formatters []Formatter
+}
+
+// NewFormatters returns a registry holding the built-in formatters of time.Time, time.Duration and big.Int
+func NewFormatters() *Formatters {
+	return &Formatters{formatters: []Formatter{
+		{Name: "time", Type: "time.Time", Format: formatTime},
+		{Name: "duration", Type: "time.Duration", Format: formatDuration},
+		{Name: "bigint", Type: "math/big.Int", Format: formatBigInt},
+	}}
+}
+
+// Register adds the formatter to the registry, it takes precedence over the formatters already registered
+func (f *Formatters) Register(formatter Formatter) {
+	f.formatters = append(f.formatters, formatter)
+}
+
+// RegisterDirectives registers the formatters declared in the source with directives like
+//
+//	//gotutor:format list Node next
+//	//gotutor:format tree Tree left right
+//
+// list shows a linked list as the values of its nodes following the given field, tree shows a tree as
+// the values of its nodes with the nodes of the given fields as children. The value of a node is made of
+// its other fields. Types without a package are looked up in main.
+func (f *Formatters) RegisterDirectives(src []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(text, _formatDirective) {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(text, _formatDirective))
+		if len(fields) < 3 {
+			return fmt.Errorf("line %d: want //gotutor:format list|tree TYPE FIELD...", line)
+		}
+		view, typeName, links := fields[0], fields[1], fields[2:]
+		if !strings.Contains(typeName, ".") {
+			typeName = "main." + typeName
+		}
+		switch ViewKind(view) {
+		case ViewList:
+			if len(links) != 1 {
+				return fmt.Errorf("line %d: a list follows a single field, got %v", line, links)
+			}
+			f.Register(Formatter{Name: "list", Type: typeName, Format: listFormatter(links[0])})
+		case ViewTree:
+			f.Register(Formatter{Name: "tree", Type: typeName, Format: treeFormatter(links)})
+		default:
+			return fmt.Errorf("line %d: unknown view %q, want list or tree", line, view)
+		}
+	}
+	return scanner.Err()
+}
+
+// Format makes the view of the variable with the last registered formatter matching its type that can format it
+func (f *Formatters) Format(variable *api.Variable) (string, View, bool) {
+	for i := len(f.formatters) - 1; i >= 0; i-- {
+		formatter := f.formatters[i]
+		if matched, _ := path.Match(formatter.Type, variable.Type); !matched {
+			continue
+		}
+		if view, ok := formatter.Format(variable); ok {
+			return formatter.Name, view, true
+		}
+	}
+	return "", View{}, false
+}
+
+// FormattedValue is the view of a variable made by a formatter
+type FormattedValue struct {
+	VariableFrame
+	// Name is the path to the formatted value from the variable holding it, e.g. "head" or "t.root"
+	Name      string `json:"name"`
+	DeclLine  int64  `json:"declLine,omitempty"`
+	Type      string `json:"type"`
+	Formatter string `json:"formatter"`
+	View      View   `json:"view"`
+}
+
+// AnnotateFormatted sets Formatted on every step to the views of the variables of the frames compared by
+// AnnotateChanges and of the package variables, and of the values they hold, the formatters have a type for.
+// The values inside a formatted value aren't formatted on their own.
+func AnnotateFormatted(steps []Step, formatters *Formatters) {
+	for i := range steps {
+		step := &steps[i]
+		step.Formatted = nil
+		forEachFrame(step, func(at variableFrame, vars []api.Variable) {
+			for j := range vars {
+				var formatted []string
+				walkVariables(&vars[j], vars[j].Name, func(name string, variable *api.Variable) {
+					if reflect.Kind(variable.Kind) == reflect.Pointer || variable.Unreadable != "" || insideFormatted(formatted, name) {
+						return
+					}
+					formatter, view, ok := formatters.Format(variable)
+					if !ok {
+						return
+					}
+					formatted = append(formatted, name)
+					step.Formatted = append(step.Formatted, FormattedValue{
+						VariableFrame: at.VariableFrame,
+						Name:          name,
+						DeclLine:      vars[j].DeclLine,
+						Type:          variable.Type,
+						Formatter:     formatter,
+						View:          view,
+					})
+				})
+			}
+		})
+	}
+}
+
+// insideFormatted checks if the named value is part of one of the formatted values
+func insideFormatted(formatted []string, name string) bool {
+	name = strings.TrimPrefix(name, "*")
+	for _, outer := range formatted {
+		if name == outer || strings.HasPrefix(name, outer+".") || strings.HasPrefix(name, outer+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// formatTime uses the value delve gives time.Time without the monotonic clock reading
+func formatTime(variable *api.Variable) (View, bool) {
+	if variable.Value == "" {
+		return View{}, false
+	}
+	text, _, _ := strings.Cut(variable.Value, ", ")
+	return View{Kind: ViewText, Text: text}, true
+}
+
+func formatDuration(variable *api.Variable) (View, bool) {
+	value := variable.Value
+	// delve names the known constants, e.g. "time.Second (1000000000)"
+	if _, constant, ok := strings.Cut(value, "("); ok {
+		value = strings.TrimSuffix(constant, ")")
+	}
+	nanoseconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return View{}, false
+	}
+	return View{Kind: ViewText, Text: time.Duration(nanoseconds).String()}, true
+}
+
+// formatBigInt decodes the sign and the little endian words of the absolute value
+func formatBigInt(variable *api.Variable) (View, bool) {
+	neg, abs := structField(variable, "neg"), structField(variable, "abs")
+	if neg == nil || abs == nil || int64(len(abs.Children)) < abs.Len {
+		return View{}, false
+	}
+	value := new(big.Int)
+	for i := len(abs.Children) - 1; i >= 0; i-- {
+		word, ok := new(big.Int).SetString(abs.Children[i].Value, 10)
+		if !ok {
+			return View{}, false
+		}
+		value.Lsh(value, 64).Or(value, word)
+	}
+	if neg.Value == "true" {
+		value.Neg(value)
+	}
+	return View{Kind: ViewText, Text: value.String()}, true
+}
+
+// listFormatter shows the linked list starting at the node as the values of its nodes
+func listFormatter(next string) func(*api.Variable) (View, bool) {
+	return func(node *api.Variable) (View, bool) {
+		if structField(node, next) == nil {
+			return View{}, false
+		}
+		view := View{Kind: ViewList}
+		seen := map[uint64]bool{}
+		for node != nil {
+			if !isLoadedStruct(node) || seen[node.Addr] {
+				// cut off by the load limits or a cycle
+				view.Truncated = true
+				break
+			}
+			seen[node.Addr] = true
+			view.Items = append(view.Items, nodeValue(node, []string{next}))
+			node, view.Truncated = followPointer(structField(node, next))
+		}
+		return view, true
+	}
+}
+
+// treeFormatter shows the tree rooted at the node with the nodes of the fields as children
+func treeFormatter(children []string) func(*api.Variable) (View, bool) {
+	var build func(node *api.Variable, view *View) TreeNode
+	build = func(node *api.Variable, view *View) TreeNode {
+		tree := TreeNode{Value: nodeValue(node, children)}
+		for _, field := range children {
+			child, truncated := followPointer(structField(node, field))
+			view.Truncated = view.Truncated || truncated
+			if child == nil {
+				continue
+			}
+			if !isLoadedStruct(child) {
+				view.Truncated = true
+				continue
+			}
+			subtree := build(child, view)
+			subtree.Field = field
+			tree.Children = append(tree.Children, subtree)
+		}
+		return tree
+	}
+	return func(node *api.Variable) (View, bool) {
+		for _, field := range children {
+			if structField(node, field) == nil {
+				return View{}, false
+			}
+		}
+		view := View{Kind: ViewTree}
+		tree := build(node, &view)
+		view.Tree = &tree
+		return view, true
+	}
+}
+
+// followPointer returns the struct the field points to, nil for nil pointers, and whether the pointer
+// wasn't followed because of the load limits
+func followPointer(field *api.Variable) (*api.Variable, bool) {
+	if field == nil || reflect.Kind(field.Kind) != reflect.Pointer || field.Value == "0" {
+		return nil, false
+	}
+	if len(field.Children) == 0 {
+		return nil, true
+	}
+	return &field.Children[0], false
+}
+
+// isLoadedStruct checks if the variable is a struct whose fields were loaded
+func isLoadedStruct(variable *api.Variable) bool {
+	return reflect.Kind(variable.Kind) == reflect.Struct && !variable.OnlyAddr && int64(len(variable.Children)) >= variable.Len
+}
+
+// nodeValue shows the fields of the node other than the links, a single field is shown as its value
+func nodeValue(node *api.Variable, links []string) string {
+	var fields []string
+	var values []string
+	for i := range node.Children {
+		field := &node.Children[i]
+		if !slices.Contains(links, field.Name) {
+			fields = append(fields, field.Name+": "+field.SinglelineString())
+			values = append(values, field.SinglelineString())
+		}
+	}
+	if len(values) == 1 {
+		return values[0]
+	}
+	return "{" + strings.Join(fields, ", ") + "}"
+}
+
+// structField returns the field of the struct, nil when there is no such field
+func structField(variable *api.Variable, name string) *api.Variable {
+	if reflect.Kind(variable.Kind) != reflect.Struct {
+		return nil
+	}
+	for i := range variable.Children {
+		if variable.Children[i].Name == name {
+			return &variable.Children[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package serialize
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// nodeVar builds a main.Node holding the values, linked through next
+func nodeVar(name string, values ...string) api.Variable {
+	next := api.Variable{Name: "next", Type: "*main.Node", Kind: 22, Value: "0"}
+	var node api.Variable
+	for i := len(values) - 1; i >= 0; i-- {
+		node = api.Variable{Name: "", Type: "main.Node", Kind: 25, Addr: uint64(0x1000 + i*0x10), Len: 2,
+			Children: []api.Variable{intVar("val", values[i]), next}}
+		next = api.Variable{Name: "next", Type: "*main.Node", Kind: 22, Value: "1", Children: []api.Variable{node}}
+	}
+	next.Name = name
+	return next
+}
+
+func TestAnnotateFormatted(t *testing.T) {
+	formatters := NewFormatters()
+	err := formatters.RegisterDirectives([]byte("package main\n\n//gotutor:format list Node next\ntype Node struct{}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := api.Variable{Name: "d", Type: "time.Duration", Kind: 6, Value: "time.Second (1000000000)"}
+	n := api.Variable{Name: "n", Type: "math/big.Int", Kind: 25, Len: 2, Children: []api.Variable{
+		{Name: "neg", Type: "bool", Kind: 1, Value: "true"},
+		{Name: "abs", Type: "math/big.nat", Kind: 23, Len: 2, Children: []api.Variable{intVar("", "0"), intVar("", "1")}},
+	}}
+	steps := []Step{newTestStep(1, "main.main", 9, nodeVar("head", "1", "2", "3"), d, n)}
+	AnnotateFormatted(steps, formatters)
+
+	main := VariableFrame{Goroutine: 1, Function: "main.main"}
+	want := []FormattedValue{
+		{VariableFrame: main, Name: "head", Type: "main.Node", Formatter: "list", View: View{Kind: ViewList, Items: []string{"1", "2", "3"}}},
+		{VariableFrame: main, Name: "d", Type: "time.Duration", Formatter: "duration", View: View{Kind: ViewText, Text: "1s"}},
+		{VariableFrame: main, Name: "n", Type: "math/big.Int", Formatter: "bigint", View: View{Kind: ViewText, Text: "-18446744073709551616"}},
+	}
+	if !reflect.DeepEqual(steps[0].Formatted, want) {
+		t.Errorf("got %+v, want %+v", steps[0].Formatted, want)
+	}
+}
+
+func TestTreeFormatter(t *testing.T) {
+	leaf := func(key string) api.Variable {
+		return api.Variable{Type: "main.Tree", Kind: 25, Len: 3, Children: []api.Variable{
+			intVar("key", key),
+			{Name: "left", Type: "*main.Tree", Kind: 22, Value: "0"},
+			{Name: "right", Type: "*main.Tree", Kind: 22, Value: "0"},
+		}}
+	}
+	root := leaf("2")
+	root.Children[1].Value, root.Children[1].Children = "1", []api.Variable{leaf("1")}
+	// the right child wasn't loaded
+	root.Children[2].Value = "2"
+
+	view, ok := treeFormatter([]string{"left", "right"})(&root)
+	if !ok {
+		t.Fatal("tree not formatted")
+	}
+	if got := view.String(); got != "2(left: 1)..." {
+		t.Errorf("got %s, want 2(left: 1)...", got)
+	}
+}
+
+func TestRegisterDirectivesErrors(t *testing.T) {
+	for _, src := range []string{"//gotutor:format list Node", "//gotutor:format graph Node next", "//gotutor:format list Node a b"} {
+		if err := NewFormatters().RegisterDirectives([]byte(src)); err == nil {
+			t.Errorf("no error for %q", src)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package serialize
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// InterfaceValue is a variable of interface type decoded into the dynamic type and the value it holds
+type InterfaceValue struct {
+	VariableFrame
+	// Name is the path to the interface from the variable holding it, e.g. "err" or "shapes[0]"
+	Name     string `json:"name"`
+	DeclLine int64  `json:"declLine,omitempty"`
+	// Type is the interface type, e.g. "error" or "main.Shape"
+	Type string `json:"type"`
+	// DynamicType is the type of the value held by the interface, e.g. "*main.Circle", empty for nil interfaces
+	DynamicType string `json:"dynamicType,omitempty"`
+	Value       string `json:"value,omitempty"`
+	// Nil is set when the interface holds nothing, only then it's equal to nil
+	Nil bool `json:"nil,omitempty"`
+	// NilValue is set when the interface holds a nil pointer, slice, map, channel or function,
+	// the interface isn't equal to nil even though the value it holds is
+	NilValue bool `json:"nilValue,omitempty"`
+	// Methods lists the methods of the interface with the methods of the dynamic type implementing them,
+	// they are known for error and for the interfaces declared in the traced source
+	Methods []InterfaceMethod `json:"methods,omitempty"`
+}
+
+// InterfaceMethod is a method of an interface
+type InterfaceMethod struct {
+	Name      string `json:"name"`
+	Signature string `json:"signature"`
+	// Implementation is the method of the dynamic type called through the interface, e.g. "(*main.Circle).Area",
+	// empty when the dynamic type isn't declared in the traced source
+	Implementation string `json:"implementation,omitempty"`
+	// Line is the line of the implementation in the traced source
+	Line int `json:"line,omitempty"`
+}
+
+// AnnotateInterfaces sets Interfaces on every step to the interface values held by the variables of the frames
+// compared by AnnotateChanges and by the package variables, including the ones in struct fields, behind pointers
+// and in the elements of arrays and slices. The methods are resolved by type checking the traced source.
+func AnnotateInterfaces(steps []Step) {
+	methods := newMethodResolver(tracedSource(steps))
+	for i := range steps {
+		step := &steps[i]
+		step.Interfaces = nil
+		forEachFrame(step, func(at variableFrame, vars []api.Variable) {
+			for j := range vars {
+				walkVariables(&vars[j], vars[j].Name, func(name string, variable *api.Variable) {
+					if reflect.Kind(variable.Kind) != reflect.Interface || variable.Unreadable != "" {
+						return
+					}
+					value := InterfaceValue{
+						VariableFrame: at.VariableFrame,
+						Name:          name,
+						DeclLine:      vars[j].DeclLine,
+						Type:          variable.Type,
+						Nil:           len(variable.Children) == 0 || reflect.Kind(variable.Children[0].Kind) == reflect.Invalid,
+					}
+					if !value.Nil {
+						held := &variable.Children[0]
+						value.DynamicType = held.Type
+						value.Value = held.SinglelineString()
+						value.NilValue = isNilValue(held)
+					}
+					value.Methods = methods.resolve(value.Type, value.DynamicType)
+					step.Interfaces = append(step.Interfaces, value)
+				})
+			}
+		})
+	}
+}
+
+// isNilValue checks if the value is a nil pointer, slice, map, channel or function
+func isNilValue(variable *api.Variable) bool {
+	switch reflect.Kind(variable.Kind) {
+	case reflect.Pointer, reflect.UnsafePointer:
+		return variable.Value == "0"
+	case reflect.Slice, reflect.Map, reflect.Chan:
+		return variable.Base == 0
+	case reflect.Func:
+		return variable.Value == ""
+	}
+	return false
+}
+
+// tracedSource returns the path of the traced main.go, found in the stacktraces of the steps
+func tracedSource(steps []Step) string {
+	for i := range steps {
+		for _, data := range steps[i].GoroutinesData {
+			for _, frame := range data.Stacktrace {
+				if isInMainDotGo(frame.File) {
+					return frame.File
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// methodResolver matches the methods of interfaces to the methods of the dynamic types implementing them
+type methodResolver struct {
+	fset     *token.FileSet
+	pkg      *types.Package
+	resolved map[[2]string][]InterfaceMethod
+}
+
+// newMethodResolver type checks the source file, the methods are only resolved for error when it can't be read
+func newMethodResolver(file string) *methodResolver {
+	resolver := &methodResolver{resolved: map[[2]string][]InterfaceMethod{}}
+	if file == "" {
+		return resolver
+	}
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return resolver
+	}
+	resolver.fset, resolver.pkg, _, err = checkSource(file, src)
+	if err != nil {
+		resolver.fset, resolver.pkg = nil, nil
+	}
+	return resolver
+}
+
+// resolve lists the methods of the interface type, implemented by the dynamic type when it's known
+func (r *methodResolver) resolve(interfaceType, dynamicType string) []InterfaceMethod {
+	key := [2]string{interfaceType, dynamicType}
+	if methods, ok := r.resolved[key]; ok {
+		return methods
+	}
+	var methods []InterfaceMethod
+	if iface, ok := r.lookup(interfaceType).(*types.Interface); ok {
+		dynamic := r.lookup(dynamicType)
+		for i := range iface.NumMethods() {
+			method := iface.Method(i)
+			resolved := InterfaceMethod{
+				Name:      method.Name(),
+				Signature: types.TypeString(method.Type(), types.RelativeTo(r.pkg)),
+			}
+			if dynamic != nil {
+				obj, _, _ := types.LookupFieldOrMethod(dynamic, true, r.pkg, method.Name())
+				if fn, ok := obj.(*types.Func); ok {
+					resolved.Implementation = fn.FullName()
+					resolved.Line = r.fset.Position(fn.Pos()).Line
+				}
+			}
+			methods = append(methods, resolved)
+		}
+	}
+	r.resolved[key] = methods
+	return methods
+}
+
+// lookup finds the type named as delve does in the traced source, interfaces are returned as their underlying type.
+// It returns nil for the types of other packages, except for error.
+func (r *methodResolver) lookup(name string) types.Type {
+	if name == "error" {
+		return types.Universe.Lookup("error").Type().Underlying()
+	}
+	pointer := strings.HasPrefix(name, "*")
+	name = strings.TrimPrefix(name, "*")
+	if r.pkg == nil || !strings.HasPrefix(name, r.pkg.Name()+".") {
+		return nil
+	}
+	typeName, ok := r.pkg.Scope().Lookup(strings.TrimPrefix(name, r.pkg.Name()+".")).(*types.TypeName)
+	if !ok {
+		return nil
+	}
+	typ := typeName.Type()
+	if pointer {
+		return types.NewPointer(typ)
+	}
+	if iface, ok := typ.Underlying().(*types.Interface); ok {
+		return iface
+	}
+	return typ
+}
+
+// nilInterfaceDetails describes the interfaces assigned in the current frame or to package variables
+// at the step that hold a nil value, which makes them not equal to nil
+func nilInterfaceDetails(step *Step) []string {
+	assigned := assignedVariables(step)
+	var details []string
+	for _, value := range step.Interfaces {
+		if value.NilValue && assigned[fmt.Sprintf("%d:%s:%d", value.Goroutine, rootVariable(value.Name), value.DeclLine)] {
+			details = append(details, fmt.Sprintf("%s holds a nil %s, so it is not equal to nil", value.Name, value.DynamicType))
+		}
+	}
+	return details
+}
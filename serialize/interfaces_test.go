@@ -0,0 +1,53 @@
+package serialize
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+const _shapeSource = `package main
+
+type Shape interface {
+	Area() float64
+}
+
+type Square struct{ side float64 }
+
+func (s *Square) Area() float64 { return s.side * s.side }
+`
+
+func TestAnnotateInterfaces(t *testing.T) {
+	nilErr := api.Variable{Name: "err", Type: "error", Kind: 20, Children: []api.Variable{{Type: "void"}}}
+	typedNil := api.Variable{Name: "err2", Type: "error", Kind: 20, Children: []api.Variable{{Name: "data", Type: "*main.MyErr", Kind: 22, Value: "0"}}}
+	steps := []Step{newTestStep(1, "main.main", 9, nilErr, typedNil)}
+	AnnotateInterfaces(steps)
+
+	errorMethods := []InterfaceMethod{{Name: "Error", Signature: "func() string"}}
+	main := VariableFrame{Goroutine: 1, Function: "main.main"}
+	want := []InterfaceValue{
+		{VariableFrame: main, Name: "err", Type: "error", Nil: true, Methods: errorMethods},
+		{VariableFrame: main, Name: "err2", Type: "error", DynamicType: "*main.MyErr", Value: "nil", NilValue: true, Methods: errorMethods},
+	}
+	if !reflect.DeepEqual(steps[0].Interfaces, want) {
+		t.Errorf("got %+v, want %+v", steps[0].Interfaces, want)
+	}
+}
+
+func TestMethodResolver(t *testing.T) {
+	resolver := newMethodResolver("")
+	var err error
+	resolver.fset, resolver.pkg, _, err = checkSource("main.go", []byte(_shapeSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []InterfaceMethod{{Name: "Area", Signature: "func() float64", Implementation: "(*main.Square).Area", Line: 9}}
+	if got := resolver.resolve("main.Shape", "*main.Square"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got := resolver.resolve("main.Shape", "*other.Square"); len(got) != 1 || got[0].Implementation != "" {
+		t.Errorf("resolved the method of a type of another package: %+v", got)
+	}
+}
@@ -0,0 +1,97 @@
+package serialize
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// _mainReturnBreakpoint is the breakpoint set on the return instructions of main.main
+const _mainReturnBreakpoint = "mainReturn"
+
+// LeakedGoroutine is a user goroutine that was still alive when main.main returned
+type LeakedGoroutine struct {
+	BlockedGoroutine
+	// CreatedAt is the go statement that started the goroutine
+	CreatedAt api.Location `json:"createdAt"`
+}
+
+// initMainReturnBreakPoint breaks just before main.main returns so the goroutines still alive can be reported
+func (v *Serializer) initMainReturnBreakPoint(ctx context.Context) error {
+	addrs, err := v.client.FunctionReturnLocations(ctx, "main.main")
+	if err != nil {
+		return fmt.Errorf("main return locations: %w", err)
+	}
+	if len(addrs) == 0 {
+		return nil
+	}
+	_, err = v.client.CreateBreakpoint(ctx, &api.Breakpoint{
+		Name:  _mainReturnBreakpoint,
+		Addrs: addrs,
+	})
+	return err
+}
+
+// isMainReturn checks if the program stopped on the breakpoint set by initMainReturnBreakPoint
+func isMainReturn(debugState *api.DebuggerState) bool {
+	return debugState.CurrentThread != nil &&
+		debugState.CurrentThread.Breakpoint != nil &&
+		debugState.CurrentThread.Breakpoint.Name == _mainReturnBreakpoint
+}
+
+// leakedGoroutines lists the user goroutines other than the main one that are still in main.go code
+func (v *Serializer) leakedGoroutines(ctx context.Context) ([]LeakedGoroutine, error) {
+	goroutines, err := v.getUserGoroutines(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get user goroutines: %w", err)
+	}
+	stacktraces := map[int64][]api.Stackframe{}
+	for _, goroutine := range goroutines {
+		if goroutine.ID == 1 {
+			continue
+		}
+		stacktraces[goroutine.ID], err = v.client.Stacktrace(ctx, goroutine.ID, 100, 0, nil)
+		if err != nil {
+			return nil, fmt.Errorf("goroutine: %d, stacktrace: %w", goroutine.ID, err)
+		}
+	}
+	leaks, frames := findLeaks(goroutines, stacktraces, v.waitReasonNamer(ctx))
+	for i := range leaks {
+		v.readBlockedOn(ctx, &leaks[i].BlockedGoroutine, frames[i])
+	}
+	return leaks, nil
+}
+
+// findLeaks lists the goroutines other than the main one that are in main.go code along with the index
+// of their frame there, the stacktraces are by goroutine ID. The goroutines are sorted latest first as
+// getUserGoroutines does, the leaks are in creation order.
+func findLeaks(goroutines []*api.Goroutine, stacktraces map[int64][]api.Stackframe, waitReason func(int64) string) ([]LeakedGoroutine, []int) {
+	var leaks []LeakedGoroutine
+	var frames []int
+	for i := len(goroutines) - 1; i >= 0; i-- {
+		goroutine := goroutines[i]
+		if goroutine.ID == 1 {
+			continue
+		}
+		blocked, frame, ok := newBlockedGoroutine(goroutine, stacktraces[goroutine.ID], waitReason)
+		if !ok {
+			continue
+		}
+		leaks = append(leaks, LeakedGoroutine{BlockedGoroutine: blocked, CreatedAt: goroutine.GoStatementLoc})
+		frames = append(frames, frame)
+	}
+	return leaks, frames
+}
+
+// describe tells the narrative where the goroutine is blocked and where it was started
+func (leak LeakedGoroutine) describe() string {
+	detail := fmt.Sprintf("goroutine %d at line %d", leak.ID, leak.Location.Line)
+	if leak.BlockedOn != "" {
+		detail = fmt.Sprintf("goroutine %d blocked on %s at line %d", leak.ID, leak.BlockedOn, leak.Location.Line)
+	}
+	if leak.WaitReason != "" {
+		detail += fmt.Sprintf(" (%s)", leak.WaitReason)
+	}
+	return detail + fmt.Sprintf(", started at line %d", leak.CreatedAt.Line)
+}
@@ -0,0 +1,58 @@
+package serialize
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+func TestFindLeaks(t *testing.T) {
+	file := writeDeadlockSource(t)
+	userFrame := func(line int) api.Stackframe {
+		return api.Stackframe{Location: api.Location{File: file, Line: line, Function: &api.Function{Name_: "main.main.func1"}}}
+	}
+	runtimeFrame := api.Stackframe{Location: api.Location{File: "/usr/local/go/src/runtime/proc.go", Line: 435, Function: &api.Function{Name_: "runtime.gopark"}}}
+	waitReason := func(reason int64) string { return "reason " + strconv.FormatInt(reason, 10) }
+	goStatement := func(line int) api.Location {
+		return api.Location{File: file, Line: line, Function: &api.Function{Name_: "main.main"}}
+	}
+
+	// latest first, as getUserGoroutines sorts them
+	goroutines := []*api.Goroutine{
+		{ID: 20, Status: api.GoroutineWaiting, WaitReason: 3, GoStatementLoc: goStatement(9)},
+		{ID: 19, GoStatementLoc: goStatement(8)},
+		{ID: 18, Status: api.GoroutineWaiting, WaitReason: 7, GoStatementLoc: goStatement(7)},
+		{ID: 1, Status: api.GoroutineWaiting},
+	}
+	stacktraces := map[int64][]api.Stackframe{
+		20: {runtimeFrame, userFrame(12)},
+		// a goroutine left in library code isn't reported
+		19: {runtimeFrame},
+		18: {runtimeFrame, userFrame(10)},
+		1:  {userFrame(13)},
+	}
+
+	leaks, frames := findLeaks(goroutines, stacktraces, waitReason)
+	want := []LeakedGoroutine{
+		{
+			BlockedGoroutine: BlockedGoroutine{ID: 18, WaitReason: "reason 7", BlockedOn: "ch", Location: userFrame(10).Location},
+			CreatedAt:        goStatement(7),
+		},
+		{
+			BlockedGoroutine: BlockedGoroutine{ID: 20, WaitReason: "reason 3", BlockedOn: "mu", Location: userFrame(12).Location},
+			CreatedAt:        goStatement(9),
+		},
+	}
+	if !reflect.DeepEqual(leaks, want) {
+		t.Errorf("got %+v, want %+v", leaks, want)
+	}
+	if !reflect.DeepEqual(frames, []int{1, 1}) {
+		t.Errorf("got frames %v, want [1 1]", frames)
+	}
+
+	if leaks, _ := findLeaks(goroutines[3:], stacktraces, waitReason); leaks != nil {
+		t.Errorf("got %+v when only the main goroutine is alive", leaks)
+	}
+}
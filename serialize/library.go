@@ -0,0 +1,69 @@
+package serialize
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// packageOf returns the import path of the package the function belongs to
+func packageOf(function string) string {
+	// drop the type parameters as they may hold import paths too
+	if i := strings.Index(function, "["); i != -1 {
+		function = function[:i]
+	}
+	slash := strings.LastIndex(function, "/")
+	dot := strings.Index(function[slash+1:], ".")
+	if dot == -1 {
+		return function
+	}
+	return function[:slash+1+dot]
+}
+
+// goRootOf returns the Go root the program was built with from the file of runtime.main in its stacktrace,
+// empty if it isn't in the stacktrace
+func goRootOf(stacktrace []api.Stackframe) string {
+	for _, frame := range stacktrace {
+		if frame.Function == nil || frame.Function.Name() != "runtime.main" {
+			continue
+		}
+		if root, _, found := strings.Cut(frame.File, "/src/runtime/"); found {
+			return root
+		}
+	}
+	return ""
+}
+
+// isInGoRoot checks if the file is in the source tree of one of the Go roots
+func isInGoRoot(file string, goRoots []string) bool {
+	return slices.ContainsFunc(goRoots, func(root string) bool {
+		return root != "" && strings.HasPrefix(file, root+"/src/")
+	})
+}
+
+// isLibraryCode checks if the location is in one of the standard library packages the user steps into,
+// runtime internals are never stepped into. The file must be in the Go root so a user package named like
+// a standard library one isn't taken for it.
+func (v *Serializer) isLibraryCode(loc api.Location) bool {
+	if len(v.opts.StepInto) == 0 || loc.Function == nil || isInMainDotGo(loc.File) || internalFunction(loc.File) {
+		return false
+	}
+	return isInGoRoot(loc.File, v.goRoots) && slices.Contains(v.opts.StepInto, packageOf(loc.Function.Name()))
+}
+
+// isRecorded checks if a step is recorded at the location
+func (v *Serializer) isRecorded(loc api.Location) bool {
+	return isInMainDotGo(loc.File) || v.isLibraryCode(loc)
+}
+
+// libraryFrames returns the indexes of the frames in the standard library packages the user steps into
+func (v *Serializer) libraryFrames(stacktrace []api.Stackframe) []int {
+	var frames []int
+	for i := range stacktrace {
+		if v.isLibraryCode(stacktrace[i].Location) {
+			frames = append(frames, i)
+		}
+	}
+	return frames
+}
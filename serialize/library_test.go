@@ -0,0 +1,69 @@
+package serialize
+
+import (
+	"testing"
+
+	"github.com/go-delve/delve/service/api"
+	"github.com/rs/zerolog"
+)
+
+func TestPackageOf(t *testing.T) {
+	tests := map[string]string{
+		"sort.Ints":                        "sort",
+		"strings.(*Builder).WriteString":   "strings",
+		"math/rand.(*Rand).Intn":           "math/rand",
+		"slices.Sort[go.shape.[]int,int]":  "slices",
+		"slices.SortFunc[example.com/x.T]": "slices",
+		"main.main.func1":                  "main",
+	}
+	for function, want := range tests {
+		if got := packageOf(function); got != want {
+			t.Errorf("packageOf(%q) = %q, want %q", function, got, want)
+		}
+	}
+}
+
+func TestGoRootOf(t *testing.T) {
+	frame := func(function, file string) api.Stackframe {
+		return api.Stackframe{Location: api.Location{File: file, Function: &api.Function{Name_: function}}}
+	}
+	stacktrace := []api.Stackframe{
+		frame("main.main", "/tmp/main.go"),
+		frame("runtime.main", "/opt/go1.24/src/runtime/proc.go"),
+		frame("runtime.goexit", "/opt/go1.24/src/runtime/asm_amd64.s"),
+	}
+	if got := goRootOf(stacktrace); got != "/opt/go1.24" {
+		t.Errorf("got %q, want /opt/go1.24", got)
+	}
+	if got := goRootOf(stacktrace[:1]); got != "" {
+		t.Errorf("got %q without runtime.main", got)
+	}
+}
+
+func TestIsLibraryCode(t *testing.T) {
+	v := NewSerializer(nil, zerolog.Nop(), Options{StepInto: []string{"sort", "strings"}})
+	v.goRoots = []string{"/usr/local/go", "/opt/go1.24"}
+	location := func(function, file string) api.Location {
+		return api.Location{File: file, Function: &api.Function{Name_: function}}
+	}
+	tests := []struct {
+		name string
+		loc  api.Location
+		want bool
+	}{
+		{name: "gotutor's Go root", loc: location("sort.Ints", "/usr/local/go/src/sort/sort.go"), want: true},
+		{name: "the program's Go root", loc: location("strings.ToUpper", "/opt/go1.24/src/strings/strings.go"), want: true},
+		{name: "package not stepped into", loc: location("fmt.Println", "/usr/local/go/src/fmt/print.go")},
+		{name: "user package named like the standard library", loc: location("sort.Ints", "/home/user/project/sort/sort.go")},
+		{name: "outside of the Go root with the same prefix", loc: location("sort.Ints", "/usr/local/gopath/src/sort/sort.go")},
+		{name: "main.go", loc: location("main.main", "/opt/go1.24/src/main.go")},
+		{name: "runtime", loc: location("runtime.gopark", "/usr/local/go/src/runtime/proc.go")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := v.isLibraryCode(tt.loc); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,415 @@
+package serialize
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// LoopIteration tells which iteration of the innermost running loop a step belongs to
+type LoopIteration struct {
+	// Line is the line of the for statement
+	Line int `json:"line"`
+	// Iteration is 1 based
+	Iteration  int `json:"iteration"`
+	Iterations int `json:"iterations"`
+}
+
+// LoopSummary describes the iterations of a loop that were not recorded in full
+type LoopSummary struct {
+	Line      int    `json:"line"`
+	Function  string `json:"function"`
+	Goroutine int64  `json:"goroutine"`
+	// FirstIteration and LastIteration are the first and last collapsed iterations, 1 based
+	FirstIteration int `json:"firstIteration"`
+	LastIteration  int `json:"lastIteration"`
+	Iterations     int `json:"iterations"`
+	// Steps is the number of steps dropped from the trace
+	Steps int `json:"steps"`
+	// Variables holds the range of values the numeric variables of the loop's frame took in the collapsed iterations
+	Variables []VariableRange `json:"variables,omitempty"`
+}
+
+// VariableRange is the smallest and largest value a numeric variable took
+type VariableRange struct {
+	Name string `json:"name"`
+	Min  string `json:"min"`
+	Max  string `json:"max"`
+}
+
+// sourceLoop is a for statement along with the function it belongs to
+type sourceLoop struct {
+	start, end int
+	function   int
+}
+
+// sourceLoops holds the line ranges of the functions and loops of a source file
+type sourceLoops struct {
+	functions [][2]int
+	loops     []sourceLoop
+}
+
+func parseSourceLoops(src []byte) (*sourceLoops, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", src, 0)
+	if err != nil {
+		return nil, fmt.Errorf("parse source: %w", err)
+	}
+	lines := func(node ast.Node) (int, int) {
+		return fset.Position(node.Pos()).Line, fset.Position(node.End()).Line
+	}
+	s := &sourceLoops{}
+	// functions is the stack of the enclosing functions of every visited node, -1 outside of functions
+	functions := []int{-1}
+	ast.Inspect(file, func(node ast.Node) bool {
+		if node == nil {
+			// Inspect calls back with nil once the children of a node are visited
+			functions = functions[:len(functions)-1]
+			return true
+		}
+		function := functions[len(functions)-1]
+		switch node.(type) {
+		case *ast.FuncDecl, *ast.FuncLit:
+			start, end := lines(node)
+			s.functions = append(s.functions, [2]int{start, end})
+			function = len(s.functions) - 1
+		case *ast.ForStmt, *ast.RangeStmt:
+			if function != -1 {
+				start, end := lines(node)
+				s.loops = append(s.loops, sourceLoop{start: start, end: end, function: function})
+			}
+		}
+		functions = append(functions, function)
+		return true
+	})
+	return s, nil
+}
+
+// loopsAt returns the header lines of the loops of the innermost function around the line, outermost first
+func (s *sourceLoops) loopsAt(line int) []int {
+	function := -1
+	for i, f := range s.functions {
+		if f[0] <= line && line <= f[1] && (function == -1 || f[0] >= s.functions[function][0]) {
+			function = i
+		}
+	}
+	var headers []int
+	for _, loop := range s.loops {
+		if loop.function == function && loop.start <= line && line <= loop.end {
+			headers = append(headers, loop.start)
+		}
+	}
+	sort.Ints(headers)
+	return headers
+}
+
+// loopKey identifies a running loop by the frame it runs in and its for statement
+type loopKey struct {
+	goroutine int64
+	depth     int
+	line      int
+}
+
+// loopInstance is a single run of a loop, from entering it until leaving it
+type loopInstance struct {
+	key      loopKey
+	function string
+	// iterations holds the indexes of the steps of every iteration
+	iterations [][]int
+	sawBody    bool
+}
+
+// loopCollapser follows the running loops of every goroutine across the steps
+type loopCollapser struct {
+	steps      []Step
+	source     *sourceLoops
+	head, tail int
+	running    map[int64][]*loopInstance
+	// counting is set when the collapser only follows the running loops, see loopCounter
+	counting   bool
+	dropped    []bool
+	iterations []*LoopIteration
+	summaries  map[int]*LoopSummary
+}
+
+// CollapseLoops keeps only the first head and the last tail iterations of every loop of the trace in full,
+// the iterations in between are summarized on the last step kept before them. The loops are found in the
+// given main.go source. Kept steps get the iteration of the innermost loop they run in, the output of dropped
+// steps is moved to the next kept step, and the per-step changes and data races, along with the slices
+// and closures when the steps hold them, are computed again. The call tree, built from all the steps, is moved to
+// the kept steps: a call made in collapsed iterations points at the step the loop summary is on.
+func CollapseLoops(resp *ExecutionResponse, src []byte, head, tail int) error {
+	source, err := parseSourceLoops(src)
+	if err != nil {
+		return err
+	}
+	// the slices and closures are only computed again when they were recorded, see Options
+	withSlices := slices.ContainsFunc(resp.Steps, func(step Step) bool { return step.Slices != nil })
+	withClosures := slices.ContainsFunc(resp.Steps, func(step Step) bool { return step.Closures != nil })
+	c := &loopCollapser{
+		steps:      resp.Steps,
+		source:     source,
+		head:       max(head, 0),
+		tail:       max(tail, 0),
+		running:    map[int64][]*loopInstance{},
+		dropped:    make([]bool, len(resp.Steps)),
+		iterations: make([]*LoopIteration, len(resp.Steps)),
+		summaries:  map[int]*LoopSummary{},
+	}
+	for i, step := range resp.Steps {
+		c.advance(i, step.GoroutinesData[0])
+	}
+	for goroutine, running := range c.running {
+		c.finish(goroutine, running, 0)
+	}
+
+	var steps []Step
+	var stdout, stderr string
+	// kept maps the index of every step to the index of the last kept step up to it
+	kept := make([]int, len(resp.Steps))
+	for i, step := range resp.Steps {
+		kept[i] = max(len(steps)-1, 0)
+		if c.dropped[i] {
+			stdout += step.StdOut
+			stderr += step.StdErr
+			continue
+		}
+		kept[i] = len(steps)
+		step.StdOut, step.StdErr = stdout+step.StdOut, stderr+step.StdErr
+		stdout, stderr = "", ""
+		step.Loop = c.iterations[i]
+		step.CollapsedLoop = c.summaries[i]
+		steps = append(steps, step)
+	}
+	if len(steps) > 0 {
+		steps[len(steps)-1].StdOut += stdout
+		steps[len(steps)-1].StdErr += stderr
+	}
+	resp.Steps = steps
+	remapCallTree(resp.CallTree, kept)
+	AnnotateChanges(resp.Steps)
+	if withSlices {
+		AnnotateSlices(resp.Steps)
+	}
+	if withClosures {
+		AnnotateClosures(resp.Steps)
+	}
+	AttachRaces(resp)
+	return nil
+}
+
+// loopCounter follows the running loops while the steps are recorded. The steps of the iterations past
+// the head of a loop are dropped by CollapseLoops, but for the ones of the last tail iterations which are
+// only known once the loop ends, so they don't count against the steps limit.
+type loopCounter struct {
+	collapser *loopCollapser
+	steps     int
+}
+
+func newLoopCounter(src []byte, head int) (*loopCounter, error) {
+	source, err := parseSourceLoops(src)
+	if err != nil {
+		return nil, err
+	}
+	return &loopCounter{collapser: &loopCollapser{
+		source:   source,
+		head:     max(head, 0),
+		running:  map[int64][]*loopInstance{},
+		counting: true,
+	}}, nil
+}
+
+// pastHead moves the running loops to the next recorded step and tells if it runs in an iteration
+// past the head of any of them, it's always false for a nil counter
+func (l *loopCounter) pastHead(step *Step) bool {
+	if l == nil {
+		return false
+	}
+	data := step.GoroutinesData[0]
+	l.collapser.advance(l.steps, data)
+	l.steps++
+	return slices.ContainsFunc(l.collapser.running[data.Goroutine.ID], func(instance *loopInstance) bool {
+		return len(instance.iterations) > l.collapser.head
+	})
+}
+
+// remapCallTree moves the first and last steps of the calls to the given indexes
+func remapCallTree(nodes []*CallNode, kept []int) {
+	for _, node := range nodes {
+		node.FirstStep, node.LastStep = kept[node.FirstStep], kept[node.LastStep]
+		remapCallTree(node.Children, kept)
+	}
+}
+
+// advance moves the running loops of the step's goroutine to the step
+func (c *loopCollapser) advance(index int, data GoRoutineData) {
+	goroutine := data.Goroutine.ID
+	type activeLoop struct {
+		key      loopKey
+		function string
+		header   bool
+	}
+	var active []activeLoop
+	for _, frame := range userFrames(data.Stacktrace) {
+		headers := c.source.loopsAt(frame.line)
+		for i, line := range headers {
+			active = append(active, activeLoop{
+				key:      loopKey{goroutine: goroutine, depth: len(data.Stacktrace) - frame.index, line: line},
+				function: frame.function,
+				// only the innermost loop of the top frame can be at its for statement
+				header: frame.index == 0 && i == len(headers)-1 && line == frame.line,
+			})
+		}
+	}
+
+	running := c.running[goroutine]
+	common := 0
+	for common < len(running) && common < len(active) && running[common].key == active[common].key && running[common].function == active[common].function {
+		common++
+	}
+	c.finish(goroutine, running, common)
+	running = running[:common]
+	for _, loop := range active[common:] {
+		running = append(running, &loopInstance{key: loop.key, function: loop.function, iterations: [][]int{nil}})
+	}
+	for i, instance := range running {
+		if active[i].header {
+			// the for statement runs before every iteration, it starts a new one once the body ran
+			if instance.sawBody {
+				instance.iterations = append(instance.iterations, nil)
+				instance.sawBody = false
+			}
+		} else {
+			instance.sawBody = true
+		}
+		last := len(instance.iterations) - 1
+		instance.iterations[last] = append(instance.iterations[last], index)
+	}
+	c.running[goroutine] = running
+}
+
+// finish ends the running loops of the goroutine from the given position, innermost first
+func (c *loopCollapser) finish(goroutine int64, running []*loopInstance, from int) {
+	for i := len(running) - 1; i >= from; i-- {
+		c.finishInstance(running[i])
+	}
+	c.running[goroutine] = running[:from]
+}
+
+func (c *loopCollapser) finishInstance(instance *loopInstance) {
+	if c.counting {
+		return
+	}
+	iterations := instance.iterations
+	// the last check of the loop condition has no body, it belongs to the last iteration
+	if last := len(iterations) - 1; last > 0 && !instance.sawBody {
+		iterations[last-1] = append(iterations[last-1], iterations[last]...)
+		iterations = iterations[:last]
+	}
+	for i, steps := range iterations {
+		for _, step := range steps {
+			// the innermost loop finishes first
+			if c.iterations[step] == nil {
+				c.iterations[step] = &LoopIteration{Line: instance.key.line, Iteration: i + 1, Iterations: len(iterations)}
+			}
+		}
+	}
+	if len(iterations) <= c.head+c.tail || len(iterations)-c.tail <= c.head {
+		return
+	}
+	collapsed := iterations[c.head : len(iterations)-c.tail]
+	summary := &LoopSummary{
+		Line:           instance.key.line,
+		Function:       instance.function,
+		Goroutine:      instance.key.goroutine,
+		FirstIteration: c.head + 1,
+		LastIteration:  len(iterations) - c.tail,
+		Iterations:     len(iterations),
+	}
+	ranges := map[string]*variableRange{}
+	var names []string
+	for _, steps := range collapsed {
+		for _, step := range steps {
+			summary.Steps++
+			c.dropped[step] = true
+			names = append(names, c.collectRanges(step, instance.key, ranges)...)
+		}
+	}
+	for _, name := range names {
+		r := ranges[name]
+		summary.Variables = append(summary.Variables, VariableRange{Name: name, Min: r.minText, Max: r.maxText})
+	}
+	// show the summary on the last step before the collapsed iterations
+	before := collapsed[0][0] - 1
+	for before >= 0 && c.dropped[before] {
+		before--
+	}
+	if before >= 0 {
+		c.summaries[before] = summary
+	}
+}
+
+type variableRange struct {
+	min, max         constant.Value
+	minText, maxText string
+}
+
+// collectRanges widens the ranges with the numeric variables of the loop's frame at the step,
+// it returns the names seen for the first time
+func (c *loopCollapser) collectRanges(index int, key loopKey, ranges map[string]*variableRange) []string {
+	var added []string
+	data := c.steps[index].GoroutinesData[0]
+	frame := len(data.Stacktrace) - key.depth
+	if frame < 0 || frame >= len(data.Stacktrace) {
+		return nil
+	}
+	variables := append(append([]api.Variable{}, data.Stacktrace[frame].Arguments...), data.Stacktrace[frame].Locals...)
+	for i := range variables {
+		switch reflect.Kind(variables[i].Kind) {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+		default:
+			continue
+		}
+		value, err := variableConstant(&variables[i])
+		if err != nil {
+			continue
+		}
+		name := variables[i].Name
+		r, ok := ranges[name]
+		if !ok {
+			ranges[name] = &variableRange{min: value, max: value, minText: variables[i].Value, maxText: variables[i].Value}
+			added = append(added, name)
+			continue
+		}
+		if constant.Compare(value, token.LSS, r.min) {
+			r.min, r.minText = value, variables[i].Value
+		}
+		if constant.Compare(value, token.GTR, r.max) {
+			r.max, r.maxText = value, variables[i].Value
+		}
+	}
+	return added
+}
+
+// describe tells the narrative which iterations were skipped and the range of values their variables took
+func (summary *LoopSummary) describe() string {
+	detail := fmt.Sprintf("skipped iterations %d-%d of %d of the loop at line %d", summary.FirstIteration, summary.LastIteration, summary.Iterations, summary.Line)
+	var ranges []string
+	for _, r := range summary.Variables {
+		ranges = append(ranges, fmt.Sprintf("%s in %s..%s", r.Name, r.Min, r.Max))
+	}
+	if len(ranges) > 0 {
+		detail += " (" + strings.Join(ranges, ", ") + ")"
+	}
+	return detail
+}
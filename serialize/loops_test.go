@@ -0,0 +1,228 @@
+package serialize
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+const _loopSource = `package main
+
+func main() {
+	sum := 0
+	for i := 0; i < 5; i++ {
+		sum += i
+	}
+}
+`
+
+func TestCollapseLoops(t *testing.T) {
+	steps := []Step{newTestStep(1, "main.main", 4, intVar("sum", "0"))}
+	sum := 0
+	for i := range 5 {
+		steps = append(steps,
+			newTestStep(1, "main.main", 5, intVar("sum", strconv.Itoa(sum))),
+			newTestStep(1, "main.main", 6, intVar("sum", strconv.Itoa(sum)), intVar("i", strconv.Itoa(i))),
+		)
+		sum += i
+	}
+	steps = append(steps, newTestStep(1, "main.main", 5, intVar("sum", strconv.Itoa(sum))))
+	steps = append(steps, newTestStep(1, "main.main", 8, intVar("sum", strconv.Itoa(sum))))
+	steps[6].StdOut = "dropped\n"
+
+	resp := ExecutionResponse{Steps: steps}
+	err := CollapseLoops(&resp, []byte(_loopSource), 1, 1)
+	if err != nil {
+		t.Fatalf("CollapseLoops: %v", err)
+	}
+
+	var lines []int
+	var iterations []int
+	for _, step := range resp.Steps {
+		lines = append(lines, step.GoroutinesData[0].Goroutine.CurrentLoc.Line)
+		iteration := 0
+		if step.Loop != nil {
+			iteration = step.Loop.Iteration
+			if step.Loop.Iterations != 5 {
+				t.Errorf("got %d iterations, want 5", step.Loop.Iterations)
+			}
+		}
+		iterations = append(iterations, iteration)
+	}
+	if want := []int{4, 5, 6, 5, 6, 5, 8}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("got lines %v, want %v", lines, want)
+	}
+	if want := []int{0, 1, 1, 5, 5, 5, 0}; !reflect.DeepEqual(iterations, want) {
+		t.Errorf("got iterations %v, want %v", iterations, want)
+	}
+
+	want := &LoopSummary{
+		Line: 5, Function: "main.main", Goroutine: 1,
+		FirstIteration: 2, LastIteration: 4, Iterations: 5, Steps: 6,
+		Variables: []VariableRange{{Name: "sum", Min: "0", Max: "3"}, {Name: "i", Min: "1", Max: "3"}},
+	}
+	if !reflect.DeepEqual(resp.Steps[2].CollapsedLoop, want) {
+		t.Errorf("got summary %+v, want %+v", resp.Steps[2].CollapsedLoop, want)
+	}
+	if resp.Steps[3].StdOut != "dropped\n" {
+		t.Errorf("output of the dropped steps moved to %q, want it on the next kept step", resp.Steps[3].StdOut)
+	}
+}
+
+func TestRecordStepsCollapsedLoopUnderLimit(t *testing.T) {
+	var stops []stop
+	stops = append(stops, stop{step: newTestStep(1, "main.main", 4)})
+	for i := range 5 {
+		stops = append(stops,
+			stop{step: newTestStep(1, "main.main", 5)},
+			stop{step: newTestStep(1, "main.main", 6, intVar("i", strconv.Itoa(i)))},
+		)
+	}
+	stops = append(stops, stop{step: newTestStep(1, "main.main", 5)}, stop{step: newTestStep(1, "main.main", 8)})
+
+	record := func(loops *loopCounter) (bool, []Step) {
+		var steps []Step
+		reachedLimit, err := recordSteps(context.Background(), 8, replayStops(stops), loops, func(_ int, step *Step) (bool, error) {
+			steps = append(steps, *step)
+			return false, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reachedLimit, steps
+	}
+	if reachedLimit, _ := record(nil); !reachedLimit {
+		t.Fatal("the loop is expected to reach the limit when counting every step")
+	}
+
+	loops, err := newLoopCounter([]byte(_loopSource), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reachedLimit, steps := record(loops)
+	if reachedLimit {
+		t.Fatal("got limit reached, the iterations past the head are not expected to count")
+	}
+	if len(steps) != len(stops) {
+		t.Fatalf("got %d steps, want %d", len(steps), len(stops))
+	}
+	resp := ExecutionResponse{Steps: steps}
+	if err := CollapseLoops(&resp, []byte(_loopSource), 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Steps) != 7 {
+		t.Errorf("got %d steps once collapsed, want 7", len(resp.Steps))
+	}
+}
+
+func TestRecordStepsInfiniteLoopEnds(t *testing.T) {
+	loops, err := newLoopCounter([]byte(_loopSource), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := 0
+	forever := func(context.Context) (Step, bool, bool, error) {
+		i++
+		return newTestStep(1, "main.main", 5+i%2), false, false, nil
+	}
+	reachedLimit, err := recordSteps(context.Background(), 10, forever, loops, func(int, *Step) (bool, error) {
+		return false, nil
+	})
+	if err != nil || !reachedLimit {
+		t.Fatalf("got reached limit %t, error %v", reachedLimit, err)
+	}
+}
+
+const _loopCallSource = `package main
+
+func main() {
+	sum := 0
+	for i := 0; i < 5; i++ {
+		sum = add(sum, i)
+	}
+}
+
+func add(a, b int) int {
+	return a + b
+}
+`
+
+func TestCollapseLoopsCallTree(t *testing.T) {
+	main := func(line int) api.Stackframe { return frameAt("main.main", line) }
+	steps := []Step{newStackStep(main(4))}
+	for i := range 5 {
+		steps = append(steps,
+			newStackStep(main(5)),
+			newStackStep(main(6)),
+			newStackStep(frameAt("main.add", 11, intVar("b", strconv.Itoa(i))), main(6)),
+		)
+	}
+	steps = append(steps, newStackStep(main(5)), newStackStep(main(8)))
+	resp := ExecutionResponse{Steps: steps}
+	resp.CallTree = BuildCallTree(resp.Steps)
+
+	collapsed := resp.Clone()
+	err := CollapseLoops(&collapsed, []byte(_loopCallSource), 1, 1)
+	if err != nil {
+		t.Fatalf("CollapseLoops: %v", err)
+	}
+	if len(resp.Steps) != len(steps) || resp.Steps[3].Loop != nil {
+		t.Error("collapsing the clone changed the steps of the original response")
+	}
+
+	calls := collapsed.CallTree[0].Children
+	if len(calls) != 5 {
+		t.Fatalf("got %d calls to add, want 5", len(calls))
+	}
+	// the calls of the collapsed iterations 2 to 4 point at the step holding the loop summary
+	var firstSteps []int
+	for _, call := range calls {
+		firstSteps = append(firstSteps, call.FirstStep)
+	}
+	if want := []int{3, 3, 3, 3, 6}; !reflect.DeepEqual(firstSteps, want) {
+		t.Errorf("got first steps %v, want %v", firstSteps, want)
+	}
+	if collapsed.Steps[3].CollapsedLoop == nil {
+		t.Error("the loop summary is not on the step the collapsed calls point at")
+	}
+	if last := collapsed.CallTree[0].LastStep; last != len(collapsed.Steps)-1 {
+		t.Errorf("got main's last step %d, want %d", last, len(collapsed.Steps)-1)
+	}
+}
+
+func TestCollapseLoopsSlicesSwitch(t *testing.T) {
+	newSteps := func() []Step {
+		steps := []Step{newTestStep(1, "main.main", 4)}
+		for range 5 {
+			steps = append(steps,
+				newTestStep(1, "main.main", 5, intSliceVar("xs", 0x1000, 2, 4)),
+				newTestStep(1, "main.main", 6, intSliceVar("xs", 0x1000, 2, 4)),
+			)
+		}
+		return append(steps, newTestStep(1, "main.main", 8, intSliceVar("xs", 0x1000, 2, 4)))
+	}
+	withSlices := func(steps []Step) bool {
+		return slices.ContainsFunc(steps, func(step Step) bool { return step.Slices != nil })
+	}
+
+	resp := ExecutionResponse{Steps: newSteps()}
+	if err := CollapseLoops(&resp, []byte(_loopSource), 1, 1); err != nil {
+		t.Fatalf("CollapseLoops: %v", err)
+	}
+	if withSlices(resp.Steps) {
+		t.Error("got slices on steps recorded without them")
+	}
+
+	resp = ExecutionResponse{Steps: newSteps()}
+	AnnotateSlices(resp.Steps)
+	if err := CollapseLoops(&resp, []byte(_loopSource), 1, 1); err != nil {
+		t.Fatalf("CollapseLoops: %v", err)
+	}
+	if !withSlices(resp.Steps) {
+		t.Error("got no slices on the kept steps of steps recorded with them")
+	}
+}
@@ -0,0 +1,116 @@
+package serialize
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// memStatsLoadConfig loads the allocation counters of the runtime, kept per size class in arrays of 68 elements
+var memStatsLoadConfig = api.LoadConfig{
+	MaxVariableRecurse: 2,
+	MaxArrayValues:     100,
+	MaxStructFields:    20,
+}
+
+// MemStats is a snapshot of the heap and garbage collector statistics of the program, read from the runtime's
+// own counters like runtime.ReadMemStats does. The runtime flushes the counters of small objects when an
+// allocation needs a new span, so they may lag behind the last allocations.
+type MemStats struct {
+	// HeapAlloc is the bytes of allocated heap objects, including the unreachable ones not yet swept
+	HeapAlloc uint64 `json:"heapAlloc"`
+	// HeapObjects is the number of allocated heap objects
+	HeapObjects uint64 `json:"heapObjects"`
+	// TotalAlloc is the cumulative bytes allocated for heap objects
+	TotalAlloc uint64 `json:"totalAlloc"`
+	// NumGC is the number of completed GC cycles
+	NumGC uint32 `json:"numGC"`
+}
+
+// readMemStats reads the heap and garbage collector statistics from the runtime's variables
+func (v *Serializer) readMemStats(ctx context.Context) (*MemStats, error) {
+	totalAlloc, err := v.evalUint(ctx, "runtime.gcController.totalAlloc.value")
+	if err != nil {
+		return nil, err
+	}
+	totalFree, err := v.evalUint(ctx, "runtime.gcController.totalFree.value")
+	if err != nil {
+		return nil, err
+	}
+	numGC, err := v.evalUint(ctx, "runtime.memstats.numgc")
+	if err != nil {
+		return nil, err
+	}
+	// the counts are split into deltas, see consistentHeapStats in the runtime
+	deltas, err := v.client.EvalVariable(ctx, api.EvalScope{GoroutineID: -1}, "runtime.memstats.heapStats.stats", memStatsLoadConfig)
+	if err != nil {
+		return nil, fmt.Errorf("eval heap stats: %w", err)
+	}
+	return newMemStats(totalAlloc, totalFree, numGC, deltas), nil
+}
+
+// newMemStats computes the statistics from the runtime's cumulative counters and the per-CPU deltas of its heap stats
+func newMemStats(totalAlloc, totalFree, numGC uint64, deltas *api.Variable) *MemStats {
+	var mallocs, frees uint64
+	for i := range deltas.Children {
+		for _, field := range deltas.Children[i].Children {
+			switch field.Name {
+			case "largeAllocCount":
+				mallocs += variableUint(&field)
+			case "largeFreeCount":
+				frees += variableUint(&field)
+			case "smallAllocCount":
+				for j := range field.Children {
+					mallocs += variableUint(&field.Children[j])
+				}
+			case "smallFreeCount":
+				for j := range field.Children {
+					frees += variableUint(&field.Children[j])
+				}
+			}
+		}
+	}
+	stats := &MemStats{
+		TotalAlloc: totalAlloc,
+		NumGC:      uint32(numGC),
+	}
+	if totalAlloc > totalFree {
+		stats.HeapAlloc = totalAlloc - totalFree
+	}
+	if mallocs > frees {
+		stats.HeapObjects = mallocs - frees
+	}
+	return stats
+}
+
+// warnRuntimeVariables logs a failure to read the runtime's variables, they change between Go versions
+// so the trace goes on without what they tell
+func (v *Serializer) warnRuntimeVariables(err error, msg string) {
+	v.logger.Warn().Err(err).Msg(msg)
+}
+
+// evalUint evaluates the expression to an unsigned integer in the current goroutine
+func (v *Serializer) evalUint(ctx context.Context, expr string) (uint64, error) {
+	variable, err := v.client.EvalVariable(ctx, api.EvalScope{GoroutineID: -1}, expr, memStatsLoadConfig)
+	if err != nil {
+		return 0, fmt.Errorf("eval %s: %w", expr, err)
+	}
+	value, err := strconv.ParseUint(variable.Value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse %s: %w", expr, err)
+	}
+	return value, nil
+}
+
+// variableUint returns the value of an unsigned integer variable, 0 when it can't be read
+func variableUint(variable *api.Variable) uint64 {
+	value, _ := strconv.ParseUint(variable.Value, 10, 64)
+	return value
+}
+
+// describe tells the narrative the size of the heap and the GC cycles so far
+func (stats *MemStats) describe() string {
+	return fmt.Sprintf("heap: %d bytes in %d objects, %d bytes allocated so far, %d GC cycles", stats.HeapAlloc, stats.HeapObjects, stats.TotalAlloc, stats.NumGC)
+}
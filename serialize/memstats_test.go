@@ -0,0 +1,55 @@
+package serialize
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// heapStatsDelta builds one element of runtime.memstats.heapStats.stats
+func heapStatsDelta(largeAlloc, largeFree uint64, smallAlloc, smallFree []uint64) api.Variable {
+	count := func(name string, value uint64) api.Variable {
+		return api.Variable{Name: name, Kind: reflect.Uint64, Value: strconv.FormatUint(value, 10)}
+	}
+	array := func(name string, values []uint64) api.Variable {
+		array := api.Variable{Name: name, Kind: reflect.Array, Len: int64(len(values))}
+		for _, value := range values {
+			array.Children = append(array.Children, count("", value))
+		}
+		return array
+	}
+	return api.Variable{Kind: reflect.Struct, Children: []api.Variable{
+		count("committed", 1<<20),
+		count("largeAllocCount", largeAlloc),
+		count("largeFreeCount", largeFree),
+		array("smallAllocCount", smallAlloc),
+		array("smallFreeCount", smallFree),
+	}}
+}
+
+func TestNewMemStats(t *testing.T) {
+	deltas := &api.Variable{Kind: reflect.Array, Children: []api.Variable{
+		heapStatsDelta(2, 1, []uint64{0, 10, 5}, []uint64{0, 4, 1}),
+		heapStatsDelta(0, 0, []uint64{0, 3, 0}, []uint64{0, 0, 2}),
+		heapStatsDelta(1, 0, []uint64{0, 0, 0}, []uint64{0, 0, 0}),
+	}}
+	got := newMemStats(4096, 1024, 3, deltas)
+	want := &MemStats{HeapAlloc: 3072, HeapObjects: 13, TotalAlloc: 4096, NumGC: 3}
+	if *got != *want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestNewMemStatsUnflushed(t *testing.T) {
+	// the frees of a delta may be flushed before the allocations, the counts never go below zero
+	deltas := &api.Variable{Kind: reflect.Array, Children: []api.Variable{
+		heapStatsDelta(0, 2, []uint64{0, 1}, []uint64{0, 3}),
+		{Kind: reflect.Struct, Unreadable: "unreadable"},
+	}}
+	got := newMemStats(100, 200, 0, deltas)
+	if want := (MemStats{TotalAlloc: 100}); *got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,125 @@
+package serialize
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// _startupRandLen is the length of the random bytes the kernel gives the program at startup, see runtime.startupRand
+const _startupRandLen = 16
+
+// Metadata describes how a trace was recorded, two traces of the same program recorded with the same
+// metadata in deterministic mode have the same steps, except for the IDs the OS gives the threads
+type Metadata struct {
+	// GoVersion is the version of the Go runtime the program was built with
+	GoVersion      string `json:"goVersion"`
+	GotutorVersion string `json:"gotutorVersion"`
+	GOMAXPROCS     int    `json:"gomaxprocs"`
+	// StepsLimit is the maximum number of steps recorded
+	StepsLimit int        `json:"stepsLimit"`
+	Load       LoadLimits `json:"load"`
+	// Deterministic is set when the random seed of the runtime was fixed, see Options.Deterministic
+	Deterministic bool `json:"deterministic"`
+	// Faketime is set when the program was built with -tags=faketime, its clock only moves when it sleeps
+	Faketime bool `json:"faketime"`
+}
+
+// gotutorVersion returns the module version gotutor was built from, "(devel)" for local builds
+func gotutorVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	return info.Main.Version
+}
+
+// readMetadata reads the Go version, GOMAXPROCS and whether faketime is used from the runtime of the program,
+// the metadata holds what could be read when an error is returned
+func (v *Serializer) readMetadata(ctx context.Context, limit int) (Metadata, error) {
+	metadata := v.newMetadata(limit)
+	var errs []error
+	eval := func(expr string, cfg api.LoadConfig) *api.Variable {
+		variable, err := v.client.EvalVariable(ctx, api.EvalScope{GoroutineID: -1}, expr, cfg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("eval %s: %w", expr, err))
+			return nil
+		}
+		return variable
+	}
+	faketime := eval("runtime.faketime", memStatsLoadConfig)
+	version := eval("runtime.buildVersion", api.LoadConfig{MaxStringLen: 64})
+	gomaxprocs := eval("runtime.gomaxprocs", memStatsLoadConfig)
+	errs = append(errs, metadata.setRuntime(faketime, version, gomaxprocs))
+	return metadata, errors.Join(errs...)
+}
+
+// newMetadata describes the run from the options of the serializer, the runtime's part is left to setRuntime
+func (v *Serializer) newMetadata(limit int) Metadata {
+	return Metadata{
+		GotutorVersion: gotutorVersion(),
+		StepsLimit:     limit,
+		Load: LoadLimits{
+			MaxVariableRecurse: v.loadConfig.MaxVariableRecurse,
+			MaxStringLen:       v.loadConfig.MaxStringLen,
+			MaxArrayValues:     v.loadConfig.MaxArrayValues,
+			MaxStructFields:    v.loadConfig.MaxStructFields,
+		},
+		Deterministic: v.opts.Deterministic,
+	}
+}
+
+// setRuntime fills the metadata from the runtime's variables, a nil variable is one that couldn't be read
+// and leaves its field unset. The output of the steps is only stripped of the playback headers when
+// Faketime is set so it's set whatever happens to the other variables.
+func (m *Metadata) setRuntime(faketime, version, gomaxprocs *api.Variable) error {
+	if faketime != nil {
+		m.Faketime = faketime.Value != "0"
+	}
+	if version != nil {
+		m.GoVersion = version.Value
+	}
+	if gomaxprocs != nil {
+		value, err := strconv.Atoi(gomaxprocs.Value)
+		if err != nil {
+			return fmt.Errorf("parse runtime.gomaxprocs: %w", err)
+		}
+		m.GOMAXPROCS = value
+	}
+	return nil
+}
+
+// fixRandomSeed runs the program until the runtime seeds its random generator and replaces the random bytes
+// the kernel gave it with fixed ones, so the map iteration order and the scheduler's choices repeat between runs
+func (v *Serializer) fixRandomSeed(ctx context.Context) error {
+	_, err := v.client.CreateBreakpoint(ctx, &api.Breakpoint{
+		Name:         "randinit",
+		FunctionName: "runtime.randinit",
+	})
+	if err != nil {
+		return fmt.Errorf("create randinit breakpoint: %w", err)
+	}
+	state, err := v.client.Continue(ctx)
+	if err != nil {
+		return fmt.Errorf("continue to randinit: %w", err)
+	}
+	if state.Exited {
+		return fmt.Errorf("the program exited before seeding its random generator")
+	}
+	for i := range _startupRandLen {
+		// randinit ignores the bytes when they are zero
+		err = v.client.SetVariable(ctx, api.EvalScope{GoroutineID: -1}, fmt.Sprintf("runtime.startupRand[%d]", i), strconv.Itoa(i+1))
+		if err != nil {
+			return fmt.Errorf("set runtime.startupRand: %w", err)
+		}
+	}
+	_, err = v.client.ClearBreakpointByName(ctx, "randinit")
+	if err != nil {
+		return fmt.Errorf("clear randinit breakpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package serialize
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-delve/delve/service/api"
+	"github.com/rs/zerolog"
+)
+
+func TestNewMetadata(t *testing.T) {
+	v := NewSerializer(nil, zerolog.Nop(), Options{Deterministic: true, Load: LoadLimits{MaxStringLen: 32}})
+	metadata := v.newMetadata(500)
+	if metadata.StepsLimit != 500 || !metadata.Deterministic {
+		t.Errorf("got %+v, want the steps limit and deterministic mode of the options", metadata)
+	}
+	if metadata.Load.MaxStringLen != 32 || metadata.Load.MaxArrayValues != DefaultLoadLimits.MaxArrayValues {
+		t.Errorf("got load limits %+v, want the options capped to the defaults", metadata.Load)
+	}
+}
+
+func TestMetadataSetRuntime(t *testing.T) {
+	intVariable := func(value string) *api.Variable {
+		return &api.Variable{Kind: reflect.Int32, Value: value}
+	}
+	version := &api.Variable{Kind: reflect.String, Value: "go1.24.1", Len: 8}
+	tests := []struct {
+		name                          string
+		faketime, version, gomaxprocs *api.Variable
+		want                          Metadata
+		wantErr                       bool
+	}{
+		{
+			name:       "all read",
+			faketime:   intVariable("1709640000000000000"),
+			version:    version,
+			gomaxprocs: intVariable("4"),
+			want:       Metadata{GoVersion: "go1.24.1", GOMAXPROCS: 4, Faketime: true},
+		},
+		{
+			name:       "faketime not used",
+			faketime:   intVariable("0"),
+			version:    version,
+			gomaxprocs: intVariable("1"),
+			want:       Metadata{GoVersion: "go1.24.1", GOMAXPROCS: 1},
+		},
+		{
+			name:     "faketime kept when the others can't be read",
+			faketime: intVariable("1709640000000000000"),
+			want:     Metadata{Faketime: true},
+		},
+		{
+			name:       "unreadable gomaxprocs",
+			faketime:   intVariable("0"),
+			version:    version,
+			gomaxprocs: &api.Variable{Kind: reflect.Int32, Unreadable: "could not read memory"},
+			want:       Metadata{GoVersion: "go1.24.1"},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var metadata Metadata
+			err := metadata.setRuntime(tt.faketime, tt.version, tt.gomaxprocs)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error: %t", err, tt.wantErr)
+			}
+			if metadata != tt.want {
+				t.Errorf("got %+v, want %+v", metadata, tt.want)
+			}
+		})
+	}
+}
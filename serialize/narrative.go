@@ -0,0 +1,345 @@
+package serialize
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// NarrativeFormat is the format used to render the execution steps as a written story
+type NarrativeFormat string
+
+const (
+	NarrativeText     NarrativeFormat = "text"
+	NarrativeMarkdown NarrativeFormat = "markdown"
+)
+
+const (
+	// _maxLoopBodySteps is the longest loop body (in steps) that is detected when collapsing repeated iterations
+	_maxLoopBodySteps = 16
+	// _minLoopRepeats is the number of identical iterations needed before they are collapsed
+	_minLoopRepeats = 3
+)
+
+// ParseNarrativeFormat validates the given format name
+func ParseNarrativeFormat(format string) (NarrativeFormat, error) {
+	switch NarrativeFormat(format) {
+	case NarrativeText, NarrativeMarkdown:
+		return NarrativeFormat(format), nil
+	}
+	return "", fmt.Errorf("unknown narrative format %q", format)
+}
+
+// WriteNarrative writes the execution steps as a human readable story, one entry per step,
+// listing the changed variables, the emitted output and goroutine switches.
+// Repeated loop iterations are collapsed into a single summary entry telling what changed in them.
+func WriteNarrative(w io.Writer, resp ExecutionResponse, format NarrativeFormat) error {
+	n := &narrator{
+		w:         w,
+		format:    format,
+		goroutine: -1,
+		races:     resp.Races,
+
+		diagnostics: resp.Diagnostics,
+		explained:   map[int]bool{},
+	}
+	steps := annotatedSteps(resp.Steps)
+	keys := make([]string, len(steps))
+	for i := range steps {
+		keys[i] = locationKey(&steps[i])
+		if steps[i].CollapsedLoop != nil || steps[i].DeferredCall != nil {
+			// keep the summary of the iterations dropped by the serializer and every deferred call in the story
+			keys[i] += fmt.Sprintf("#%d", i)
+		}
+	}
+
+	for i := 0; i < len(steps); {
+		period, repeats := repeatedBlock(keys, i)
+		if repeats < _minLoopRepeats {
+			if err := n.writeStep(&steps[i]); err != nil {
+				return err
+			}
+			i++
+			continue
+		}
+		for j := i; j < i+period; j++ {
+			if err := n.writeStep(&steps[j]); err != nil {
+				return err
+			}
+		}
+		collapsedEnd := i + period*repeats
+		if err := n.writeCollapsed(&steps[i], &steps[i+period-1], steps[i+period:collapsedEnd], repeats-1); err != nil {
+			return err
+		}
+		i = collapsedEnd
+	}
+	return n.writeLeaks(resp.Leaks)
+}
+
+// writeLeaks lists the goroutines that were still alive when main returned
+func (n *narrator) writeLeaks(leaks []LeakedGoroutine) error {
+	if len(leaks) == 0 {
+		return nil
+	}
+	line := fmt.Sprintf("main returned while %d goroutines were still alive", len(leaks))
+	if len(leaks) == 1 {
+		line = "main returned while 1 goroutine was still alive"
+	}
+	var details []string
+	for _, leak := range leaks {
+		details = append(details, leak.describe())
+	}
+	return n.writeEntry(line, details)
+}
+
+type narrator struct {
+	w         io.Writer
+	format    NarrativeFormat
+	goroutine int64
+	count     int
+	races     []DataRace
+	// memStats is the last memory stats reported
+	memStats *MemStats
+	// virtualTime is the last virtual time reported
+	virtualTime time.Duration
+	// diagnostics are the compiler diagnostics of the program, explained holds the indexes of those already told
+	diagnostics []CompilerDiagnostic
+	explained   map[int]bool
+}
+
+func (n *narrator) writeStep(step *Step) error {
+	data := step.GoroutinesData[0]
+	switched := n.goroutine != -1 && n.goroutine != data.Goroutine.ID
+	n.goroutine = data.Goroutine.ID
+	n.count++
+
+	loc := data.Goroutine.CurrentLoc
+	var line string
+	if n.format == NarrativeMarkdown {
+		line = fmt.Sprintf("%d. **line %d** in `%s()`", n.count, loc.Line, shortFunctionName(loc.Function))
+	} else {
+		line = fmt.Sprintf("%d. line %d in %s()", n.count, loc.Line, shortFunctionName(loc.Function))
+	}
+	if changes := stepChanges(step); len(changes) > 0 {
+		line += ": " + n.changeList(changes)
+	}
+	details := []string{}
+	if switched {
+		details = append(details, fmt.Sprintf("switched to goroutine %d", data.Goroutine.ID))
+	}
+	details = append(details, n.outputLines(step.StdOut, step.StdErr)...)
+	details = append(details, n.stepDetails(step)...)
+	return n.writeEntry(line, details)
+}
+
+// stepDetails tells what the features recorded on the step, each one phrased next to its feature
+func (n *narrator) stepDetails(step *Step) []string {
+	var details []string
+	if step.Deadlock != nil {
+		details = append(details, step.Deadlock.describe()...)
+	}
+	if step.CollapsedLoop != nil {
+		details = append(details, step.CollapsedLoop.describe())
+	}
+	details = append(details, reallocationDetails(step)...)
+	details = append(details, closureDetails(step)...)
+	details = append(details, shadowDetails(step)...)
+	details = append(details, nilInterfaceDetails(step)...)
+	if step.DeferredCall != nil {
+		details = append(details, step.DeferredCall.describe())
+	}
+	for _, index := range step.Races {
+		details = append(details, n.races[index].describe())
+	}
+	details = append(details, n.diagnosticDetails(step)...)
+	if t := step.VirtualTime; t != nil && *t != n.virtualTime {
+		details = append(details, fmt.Sprintf("t = %.3fs", t.Seconds()))
+		n.virtualTime = *t
+	}
+	if stats := step.MemStats; stats != nil && (n.memStats == nil || *stats != *n.memStats) {
+		details = append(details, stats.describe())
+		n.memStats = stats
+	}
+	return details
+}
+
+// diagnosticDetails tells the escape analysis and inlining decisions of the compiler for the step's line,
+// the first time the line runs
+func (n *narrator) diagnosticDetails(step *Step) []string {
+	var details []string
+	for _, index := range step.Diagnostics {
+		if n.explained[index] {
+			continue
+		}
+		n.explained[index] = true
+		if detail := n.diagnostics[index].describe(); detail != "" {
+			details = append(details, detail)
+		}
+	}
+	return details
+}
+
+// writeCollapsed tells the repeated steps in a single entry: their output, the last values of the variables
+// they changed and what their features recorded, told once
+func (n *narrator) writeCollapsed(first, last *Step, repeated []Step, iterations int) error {
+	from := first.GoroutinesData[0].Goroutine.CurrentLoc.Line
+	to := last.GoroutinesData[0].Goroutine.CurrentLoc.Line
+	lines := fmt.Sprintf("line %d", from)
+	if from != to {
+		lines = fmt.Sprintf("lines %d-%d", from, to)
+	}
+	line := fmt.Sprintf("   ... %s repeated %d more times", lines, iterations)
+	if n.format == NarrativeMarkdown {
+		line = fmt.Sprintf("   - _%s repeated %d more times_", lines, iterations)
+	}
+
+	var stdout, stderr strings.Builder
+	var changed []VariableChange
+	latest := map[string]int{}
+	var details []string
+	told := map[string]bool{}
+	for i := range repeated {
+		step := &repeated[i]
+		n.goroutine = step.GoroutinesData[0].Goroutine.ID
+		stdout.WriteString(step.StdOut)
+		stderr.WriteString(step.StdErr)
+		for _, change := range topFrameChanges(step) {
+			key := fmt.Sprintf("%d:%s:%d", change.Goroutine, change.Name, change.DeclLine)
+			if index, ok := latest[key]; ok {
+				changed[index] = change
+				continue
+			}
+			latest[key] = len(changed)
+			changed = append(changed, change)
+		}
+		for _, detail := range n.stepDetails(step) {
+			if !told[detail] {
+				told[detail] = true
+				details = append(details, detail)
+			}
+		}
+	}
+	entries := n.outputLines(stdout.String(), stderr.String())
+	if len(changed) > 0 {
+		var changes []string
+		for _, change := range changed {
+			changes = append(changes, fmt.Sprintf("%s = %s", change.Name, change.Value))
+		}
+		entries = append(entries, "last values: "+n.changeList(changes))
+	}
+	return n.writeEntry(line, append(entries, details...))
+}
+
+// changeList joins the changes of variables, quoted as code in markdown
+func (n *narrator) changeList(changes []string) string {
+	if n.format == NarrativeMarkdown {
+		return "`" + strings.Join(changes, "`, `") + "`"
+	}
+	return strings.Join(changes, ", ")
+}
+
+func (n *narrator) outputLines(stdout, stderr string) []string {
+	var lines []string
+	if stdout != "" {
+		lines = append(lines, "output: "+n.quote(stdout))
+	}
+	if stderr != "" {
+		lines = append(lines, "error output: "+n.quote(stderr))
+	}
+	return lines
+}
+
+func (n *narrator) quote(s string) string {
+	if n.format == NarrativeMarkdown {
+		return "`" + strings.ReplaceAll(fmt.Sprintf("%q", s), "`", "'") + "`"
+	}
+	return fmt.Sprintf("%q", s)
+}
+
+func (n *narrator) writeEntry(line string, details []string) error {
+	if _, err := fmt.Fprintln(n.w, line); err != nil {
+		return err
+	}
+	for _, detail := range details {
+		prefix := "   "
+		if n.format == NarrativeMarkdown {
+			prefix = "   - "
+		}
+		if _, err := fmt.Fprintln(n.w, prefix+detail); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stepChanges returns the variables of the package and of the current goroutine's top frame
+// that were created or changed in the step, see topFrameChanges
+func stepChanges(step *Step) []string {
+	var changes []string
+	for _, change := range topFrameChanges(step) {
+		changes = append(changes, fmt.Sprintf("%s = %s", change.Name, change.Value))
+	}
+	return changes
+}
+
+// topFrameChanges returns the changes of the variables of the package and of the current goroutine's top frame
+// that were created or changed in the step, their value is the formatted one when a formatter made a view of them
+func topFrameChanges(step *Step) []VariableChange {
+	goroutine := step.GoroutinesData[0].Goroutine.ID
+	views := map[string]string{}
+	for _, formatted := range step.Formatted {
+		views[fmt.Sprintf("%d:%d:%s:%d", formatted.Goroutine, formatted.Frame, formatted.Name, formatted.DeclLine)] = formatted.View.String()
+	}
+	var changes []VariableChange
+	for _, change := range step.Changes {
+		if change.Kind == VariableRemoved {
+			continue
+		}
+		if change.Goroutine != 0 && (change.Goroutine != goroutine || change.Frame != 0) {
+			continue
+		}
+		if view, ok := views[fmt.Sprintf("%d:%d:%s:%d", change.Goroutine, change.Frame, change.Name, change.DeclLine)]; ok {
+			change.Value = view
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// repeatedBlock finds the shortest block of steps starting at start that repeats back to back,
+// it returns the block length and how many times it occurs
+func repeatedBlock(keys []string, start int) (int, int) {
+	for period := 1; period <= _maxLoopBodySteps && start+period*_minLoopRepeats <= len(keys); period++ {
+		repeats := 1
+		for next := start + period; next+period <= len(keys) && equalBlocks(keys, start, next, period); next += period {
+			repeats++
+		}
+		if repeats >= _minLoopRepeats {
+			return period, repeats
+		}
+	}
+	return 0, 0
+}
+
+func equalBlocks(keys []string, first, second, length int) bool {
+	for i := range length {
+		if keys[first+i] != keys[second+i] {
+			return false
+		}
+	}
+	return true
+}
+
+func locationKey(step *Step) string {
+	data := step.GoroutinesData[0]
+	loc := data.Goroutine.CurrentLoc
+	return fmt.Sprintf("%d:%s:%d:%d", data.Goroutine.ID, loc.Function.Name(), loc.Line, len(data.Stacktrace))
+}
+
+// shortFunctionName drops the main package prefix from the function name
+func shortFunctionName(fn *api.Function) string {
+	return strings.TrimPrefix(fn.Name(), "main.")
+}
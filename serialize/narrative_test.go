@@ -0,0 +1,151 @@
+package serialize
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+func newTestStep(goroutineID int64, function string, line int, locals ...api.Variable) Step {
+	loc := api.Location{File: "/tmp/main.go", Line: line, Function: &api.Function{Name_: function}}
+	return Step{
+		GoroutinesData: []GoRoutineData{{
+			Goroutine:  &api.Goroutine{ID: goroutineID, CurrentLoc: loc, UserCurrentLoc: loc},
+			Stacktrace: []api.Stackframe{{Location: loc, Locals: locals}},
+		}},
+	}
+}
+
+func intVar(name, value string) api.Variable {
+	return api.Variable{Name: name, Type: "int", RealType: "int", Kind: 2, Value: value}
+}
+
+func TestWriteNarrative(t *testing.T) {
+	greeting := newTestStep(1, "main.hello", 17, api.Variable{Name: "greeting", Type: "string", RealType: "string", Kind: 24, Value: "Hello, World!", Len: 13})
+	greeting.StdOut = "Hello\n"
+	resp := ExecutionResponse{Steps: []Step{
+		newTestStep(1, "main.hello", 16),
+		greeting,
+		newTestStep(18, "main.work", 40),
+	}}
+
+	var out strings.Builder
+	err := WriteNarrative(&out, resp, NarrativeText)
+	if err != nil {
+		t.Fatalf("WriteNarrative: %v", err)
+	}
+	want := `1. line 16 in hello()
+2. line 17 in hello(): greeting = "Hello, World!"
+   output: "Hello\n"
+3. line 40 in work()
+   switched to goroutine 18
+`
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestWriteNarrativeCollapsesLoops(t *testing.T) {
+	steps := []Step{newTestStep(1, "main.main", 6, intVar("sum", "0"))}
+	for i := range 5 {
+		steps = append(steps,
+			newTestStep(1, "main.main", 7, intVar("sum", "0"), intVar("i", "0")),
+			newTestStep(1, "main.main", 8, intVar("sum", "0"), intVar("i", string(rune('0'+i)))),
+		)
+	}
+	steps = append(steps, newTestStep(1, "main.main", 10, intVar("sum", "10")))
+	// the details of the repeated steps are told along with their summary
+	steps[5].Slices = []SliceHeader{{VariableFrame: VariableFrame{Goroutine: 1}, Name: "s", Reallocated: true, PreviousCap: 1, Cap: 2}}
+
+	var out strings.Builder
+	err := WriteNarrative(&out, ExecutionResponse{Steps: steps}, NarrativeMarkdown)
+	if err != nil {
+		t.Fatalf("WriteNarrative: %v", err)
+	}
+	want := "1. **line 6** in `main()`: `sum = 0`\n" +
+		"2. **line 7** in `main()`: `i = 0`\n" +
+		"3. **line 8** in `main()`\n" +
+		"   - _lines 7-8 repeated 4 more times_\n" +
+		"   - last values: `i = 4`\n" +
+		"   - s moved to a new backing array (cap 1 -> 2)\n" +
+		"4. **line 10** in `main()`: `sum = 10`\n"
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestWriteNarrativeLeaks(t *testing.T) {
+	resp := ExecutionResponse{
+		Steps: []Step{newTestStep(1, "main.main", 14)},
+		Leaks: []LeakedGoroutine{{
+			BlockedGoroutine: BlockedGoroutine{ID: 6, WaitReason: "chan receive", BlockedOn: "ch", Location: api.Location{Line: 6}},
+			CreatedAt:        api.Location{Line: 12},
+		}},
+	}
+
+	var out strings.Builder
+	err := WriteNarrative(&out, resp, NarrativeText)
+	if err != nil {
+		t.Fatalf("WriteNarrative: %v", err)
+	}
+	want := `1. line 14 in main()
+main returned while 1 goroutine was still alive
+   goroutine 6 blocked on ch at line 6 (chan receive), started at line 12
+`
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestWriteNarrativeMemStats(t *testing.T) {
+	steps := []Step{newTestStep(1, "main.main", 6), newTestStep(1, "main.main", 7), newTestStep(1, "main.main", 8)}
+	steps[0].MemStats = &MemStats{HeapAlloc: 1024, HeapObjects: 4, TotalAlloc: 2048}
+	steps[1].MemStats = &MemStats{HeapAlloc: 1024, HeapObjects: 4, TotalAlloc: 2048}
+	steps[2].MemStats = &MemStats{HeapAlloc: 512, HeapObjects: 2, TotalAlloc: 4096, NumGC: 1}
+
+	var out strings.Builder
+	err := WriteNarrative(&out, ExecutionResponse{Steps: steps}, NarrativeText)
+	if err != nil {
+		t.Fatalf("WriteNarrative: %v", err)
+	}
+	want := `1. line 6 in main()
+   heap: 1024 bytes in 4 objects, 2048 bytes allocated so far, 0 GC cycles
+2. line 7 in main()
+3. line 8 in main()
+   heap: 512 bytes in 2 objects, 4096 bytes allocated so far, 1 GC cycles
+`
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestWriteNarrativeVirtualTime(t *testing.T) {
+	steps := []Step{newTestStep(1, "main.main", 6), newTestStep(1, "main.main", 7), newTestStep(1, "main.main", 8)}
+	start, slept := time.Duration(0), 2*time.Second
+	steps[0].VirtualTime, steps[1].VirtualTime, steps[2].VirtualTime = &start, &slept, &slept
+
+	var out strings.Builder
+	err := WriteNarrative(&out, ExecutionResponse{Steps: steps}, NarrativeText)
+	if err != nil {
+		t.Fatalf("WriteNarrative: %v", err)
+	}
+	want := `1. line 6 in main()
+2. line 7 in main()
+   t = 2.000s
+3. line 8 in main()
+`
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestParseNarrativeFormat(t *testing.T) {
+	if _, err := ParseNarrativeFormat("markdown"); err != nil {
+		t.Errorf("markdown: unexpected error %v", err)
+	}
+	if _, err := ParseNarrativeFormat("html"); err == nil {
+		t.Error("html: expected error")
+	}
+}
@@ -0,0 +1,318 @@
+package serialize
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// TraceQuery is a question about a recorded trace, exactly one of Variable, Expression or Line is set
+type TraceQuery struct {
+	// Variable asks for every value the variable had
+	Variable string `json:"variable,omitempty"`
+	// Function restricts Variable to the frames of the given function, empty means package variables
+	Function string `json:"function,omitempty"`
+	// Expression asks for the first step where the Go boolean expression is true,
+	// it's evaluated against the variables of the current frame and the package variables
+	Expression string `json:"expression,omitempty"`
+	// Line asks for every step at the given line
+	Line int `json:"line,omitempty"`
+}
+
+// QueryResult is the answer to a TraceQuery
+type QueryResult struct {
+	// History holds the values of the queried variable
+	History []VariableValue `json:"history,omitempty"`
+	// Steps holds the steps at the queried line, or the first step where the expression is true
+	Steps []int `json:"steps,omitempty"`
+}
+
+// VariableValue is the value a variable got at a step
+type VariableValue struct {
+	Step      int    `json:"step"`
+	Goroutine int64  `json:"goroutine,omitempty"`
+	Value     string `json:"value"`
+}
+
+// QueryTrace answers the query over the given steps
+func QueryTrace(steps []Step, query TraceQuery) (QueryResult, error) {
+	switch {
+	case query.Variable != "":
+		return QueryResult{History: VariableHistory(steps, query.Function, query.Variable)}, nil
+	case query.Expression != "":
+		step, err := FirstStepWhere(steps, query.Expression)
+		if err != nil {
+			return QueryResult{}, err
+		}
+		if step == -1 {
+			return QueryResult{}, nil
+		}
+		return QueryResult{Steps: []int{step}}, nil
+	case query.Line != 0:
+		return QueryResult{Steps: StepsAtLine(steps, query.Line)}, nil
+	}
+	return QueryResult{}, errors.New("the query needs a variable, an expression or a line")
+}
+
+// VariableHistory lists the steps where the variable was created or changed along with its new value,
+// the function and the package variables may be given with or without the main package prefix,
+// an empty function means package variables
+func VariableHistory(steps []Step, function, name string) []VariableValue {
+	function = strings.TrimPrefix(function, "main.")
+	var history []VariableValue
+	for i, step := range annotatedSteps(steps) {
+		for _, change := range step.Changes {
+			if change.Kind == VariableRemoved || strings.TrimPrefix(change.Function, "main.") != function {
+				continue
+			}
+			// delve names the package variables after their package, e.g. main.x
+			if change.Name != name && (function != "" || change.Name != "main."+name) {
+				continue
+			}
+			history = append(history, VariableValue{Step: i, Goroutine: change.Goroutine, Value: change.Value})
+		}
+	}
+	return history
+}
+
+// FirstStepWhere returns the first step where the boolean expression is true, or -1 if it never is.
+// Steps where the expression refers to variables that are not in scope are skipped.
+func FirstStepWhere(steps []Step, expression string) (int, error) {
+	expr, err := parser.ParseExpr(expression)
+	if err != nil {
+		return -1, fmt.Errorf("parse expression: %w", err)
+	}
+	for i := range steps {
+		value, err := evalExpr(expr, &steps[i])
+		if err != nil {
+			continue
+		}
+		if value.Kind() != constant.Bool {
+			return -1, fmt.Errorf("expression %q is not boolean", expression)
+		}
+		if constant.BoolVal(value) {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+// StepsAtLine returns the steps where the current goroutine is at the given line
+func StepsAtLine(steps []Step, line int) []int {
+	var matches []int
+	for i := range steps {
+		if steps[i].GoroutinesData[0].Goroutine.CurrentLoc.Line == line {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+// annotatedSteps returns the steps with their changes, computing them for traces recorded before
+// the steps were annotated
+func annotatedSteps(steps []Step) []Step {
+	for i := range steps {
+		if len(steps[i].Changes) > 0 {
+			return steps
+		}
+	}
+	steps = slices.Clone(steps)
+	AnnotateChanges(steps)
+	return steps
+}
+
+// evalExpr evaluates a constant expression where identifiers are the variables visible at the step
+func evalExpr(expr ast.Expr, step *Step) (constant.Value, error) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		value := constant.MakeFromLiteral(e.Value, e.Kind, 0)
+		if value.Kind() == constant.Unknown {
+			return nil, fmt.Errorf("invalid literal %s", e.Value)
+		}
+		return value, nil
+	case *ast.ParenExpr:
+		return evalExpr(e.X, step)
+	case *ast.UnaryExpr:
+		x, err := evalExpr(e.X, step)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case e.Op == token.NOT && x.Kind() == constant.Bool:
+		case (e.Op == token.SUB || e.Op == token.ADD) && compatibleKinds(x.Kind(), constant.Int):
+		default:
+			return nil, fmt.Errorf("invalid operation %s on %s", e.Op, x)
+		}
+		return constant.UnaryOp(e.Op, x, 0), nil
+	case *ast.BinaryExpr:
+		return evalBinaryExpr(e, step)
+	case *ast.CallExpr:
+		fn, ok := e.Fun.(*ast.Ident)
+		if !ok || fn.Name != "len" || len(e.Args) != 1 {
+			return nil, errors.New("only len calls are supported")
+		}
+		variable, err := lookupVariable(e.Args[0], step)
+		if err != nil {
+			return nil, err
+		}
+		return constant.MakeInt64(variable.Len), nil
+	case *ast.Ident:
+		if e.Name == "true" || e.Name == "false" {
+			return constant.MakeBool(e.Name == "true"), nil
+		}
+	}
+	variable, err := lookupVariable(expr, step)
+	if err != nil {
+		return nil, err
+	}
+	return variableConstant(variable)
+}
+
+func evalBinaryExpr(e *ast.BinaryExpr, step *Step) (constant.Value, error) {
+	x, err := evalExpr(e.X, step)
+	if err != nil {
+		return nil, err
+	}
+	if e.Op == token.LAND || e.Op == token.LOR {
+		if x.Kind() != constant.Bool {
+			return nil, fmt.Errorf("invalid operation %s on %s", e.Op, x)
+		}
+		// short circuit so the right side may refer to variables that are not in scope
+		if constant.BoolVal(x) == (e.Op == token.LOR) {
+			return x, nil
+		}
+	}
+	y, err := evalExpr(e.Y, step)
+	if err != nil {
+		return nil, err
+	}
+	if !compatibleKinds(x.Kind(), y.Kind()) {
+		return nil, fmt.Errorf("mismatched operands %s and %s", x, y)
+	}
+	numeric := compatibleKinds(x.Kind(), constant.Int)
+	switch e.Op {
+	case token.EQL, token.NEQ:
+		return constant.MakeBool(constant.Compare(x, e.Op, y)), nil
+	case token.LSS, token.LEQ, token.GTR, token.GEQ:
+		if x.Kind() == constant.Bool {
+			return nil, fmt.Errorf("invalid operation %s on %s", e.Op, x)
+		}
+		return constant.MakeBool(constant.Compare(x, e.Op, y)), nil
+	case token.LAND, token.LOR:
+		// the left side didn't short circuit so the result is the right side
+		if y.Kind() != constant.Bool {
+			return nil, fmt.Errorf("invalid operation %s on %s", e.Op, y)
+		}
+		return y, nil
+	case token.ADD:
+		if x.Kind() == constant.Bool {
+			return nil, fmt.Errorf("invalid operation %s on %s", e.Op, x)
+		}
+		return constant.BinaryOp(x, e.Op, y), nil
+	case token.SUB, token.MUL:
+		if !numeric {
+			return nil, fmt.Errorf("invalid operation %s on %s", e.Op, x)
+		}
+		return constant.BinaryOp(x, e.Op, y), nil
+	case token.QUO, token.REM:
+		if !numeric || e.Op == token.REM && (x.Kind() != constant.Int || y.Kind() != constant.Int) {
+			return nil, fmt.Errorf("invalid operation %s on %s", e.Op, x)
+		}
+		if constant.Sign(y) == 0 {
+			return nil, errors.New("division by zero")
+		}
+		if e.Op == token.QUO && x.Kind() == constant.Int && y.Kind() == constant.Int {
+			// integer division as in Go
+			return constant.BinaryOp(x, token.QUO_ASSIGN, y), nil
+		}
+		return constant.BinaryOp(x, e.Op, y), nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s", e.Op)
+}
+
+func compatibleKinds(x, y constant.Kind) bool {
+	numeric := func(kind constant.Kind) bool { return kind == constant.Int || kind == constant.Float }
+	return x == y || numeric(x) && numeric(y)
+}
+
+// lookupVariable resolves an identifier, a field selector or a constant index against the variables
+// of the current goroutine's top frame and the package variables
+func lookupVariable(expr ast.Expr, step *Step) (*api.Variable, error) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		var scopes [][]api.Variable
+		if stacktrace := step.GoroutinesData[0].Stacktrace; len(stacktrace) > 0 {
+			scopes = append(scopes, stacktrace[0].Locals, stacktrace[0].Arguments)
+		}
+		scopes = append(scopes, step.PackageVariables)
+		for _, vars := range scopes {
+			// the innermost declaration comes last when a name is shadowed
+			for i := len(vars) - 1; i >= 0; i-- {
+				if vars[i].Name == e.Name || vars[i].Name == "main."+e.Name {
+					return &vars[i], nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("%s is not in scope", e.Name)
+	case *ast.SelectorExpr:
+		parent, err := lookupVariable(e.X, step)
+		if err != nil {
+			return nil, err
+		}
+		if reflect.Kind(parent.Kind) == reflect.Pointer && len(parent.Children) == 1 {
+			parent = &parent.Children[0]
+		}
+		for i := range parent.Children {
+			if parent.Children[i].Name == e.Sel.Name {
+				return &parent.Children[i], nil
+			}
+		}
+		return nil, fmt.Errorf("%s has no field %s", parent.Name, e.Sel.Name)
+	case *ast.IndexExpr:
+		parent, err := lookupVariable(e.X, step)
+		if err != nil {
+			return nil, err
+		}
+		literal, ok := e.Index.(*ast.BasicLit)
+		if !ok || literal.Kind != token.INT {
+			return nil, errors.New("only constant indexes are supported")
+		}
+		index, err := strconv.Atoi(literal.Value)
+		if err != nil || index < 0 || index >= len(parent.Children) {
+			return nil, fmt.Errorf("index %s out of range", literal.Value)
+		}
+		return &parent.Children[index], nil
+	}
+	return nil, fmt.Errorf("unsupported expression %T", expr)
+}
+
+// variableConstant converts the value of a variable of a basic type to a constant
+func variableConstant(variable *api.Variable) (constant.Value, error) {
+	var value constant.Value
+	switch reflect.Kind(variable.Kind) {
+	case reflect.Bool:
+		value = constant.MakeBool(variable.Value == "true")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		value = constant.MakeFromLiteral(variable.Value, token.INT, 0)
+	case reflect.Float32, reflect.Float64:
+		value = constant.MakeFromLiteral(variable.Value, token.FLOAT, 0)
+	case reflect.String:
+		value = constant.MakeString(variable.Value)
+	default:
+		return nil, fmt.Errorf("%s of type %s can't be compared", variable.Name, variable.Type)
+	}
+	if value.Kind() == constant.Unknown {
+		return nil, fmt.Errorf("%s has an unreadable value %q", variable.Name, variable.Value)
+	}
+	return value, nil
+}
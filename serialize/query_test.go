@@ -0,0 +1,94 @@
+package serialize
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+func newCountSteps() []Step {
+	var steps []Step
+	for i := range 5 {
+		value := string(rune('0' + i))
+		steps = append(steps, newTestStep(1, "main.main", 7+i%2, intVar("count", value)))
+	}
+	return steps
+}
+
+func TestQueryTraceVariableHistory(t *testing.T) {
+	result, err := QueryTrace(newCountSteps(), TraceQuery{Variable: "count", Function: "main"})
+	if err != nil {
+		t.Fatalf("QueryTrace: %v", err)
+	}
+	want := []VariableValue{
+		{Step: 0, Goroutine: 1, Value: "0"},
+		{Step: 1, Goroutine: 1, Value: "1"},
+		{Step: 2, Goroutine: 1, Value: "2"},
+		{Step: 3, Goroutine: 1, Value: "3"},
+		{Step: 4, Goroutine: 1, Value: "4"},
+	}
+	if !reflect.DeepEqual(result.History, want) {
+		t.Errorf("got %+v, want %+v", result.History, want)
+	}
+}
+
+func TestQueryTracePackageVariableHistory(t *testing.T) {
+	steps := newCountSteps()
+	for i := range steps {
+		steps[i].PackageVariables = []api.Variable{intVar("main.total", string(rune('0'+i/2)))}
+	}
+	want := []VariableValue{
+		{Step: 0, Value: "0"},
+		{Step: 2, Value: "1"},
+		{Step: 4, Value: "2"},
+	}
+	for _, name := range []string{"total", "main.total"} {
+		result, err := QueryTrace(steps, TraceQuery{Variable: name})
+		if err != nil {
+			t.Fatalf("QueryTrace: %v", err)
+		}
+		if !reflect.DeepEqual(result.History, want) {
+			t.Errorf("%s: got %+v, want %+v", name, result.History, want)
+		}
+	}
+	// the locals of main.main are not package variables
+	if result, _ := QueryTrace(steps, TraceQuery{Variable: "count"}); len(result.History) != 0 {
+		t.Errorf("got %+v for a local queried as a package variable", result.History)
+	}
+}
+
+func TestQueryTraceExpression(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       []int
+	}{
+		{expression: "count == 3", want: []int{3}},
+		{expression: "count*2 > 5 && count%2 == 0", want: []int{4}},
+		{expression: "count == 1 || missing > 0", want: []int{1}},
+		{expression: "count > 10", want: nil},
+	}
+	for _, tt := range tests {
+		result, err := QueryTrace(newCountSteps(), TraceQuery{Expression: tt.expression})
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.expression, err)
+			continue
+		}
+		if !reflect.DeepEqual(result.Steps, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.expression, result.Steps, tt.want)
+		}
+	}
+	if _, err := QueryTrace(newCountSteps(), TraceQuery{Expression: "count + 1"}); err == nil {
+		t.Error("expected an error for a non boolean expression")
+	}
+}
+
+func TestQueryTraceLine(t *testing.T) {
+	result, err := QueryTrace(newCountSteps(), TraceQuery{Line: 8})
+	if err != nil {
+		t.Fatalf("QueryTrace: %v", err)
+	}
+	if want := []int{1, 3}; !reflect.DeepEqual(result.Steps, want) {
+		t.Errorf("got %v, want %v", result.Steps, want)
+	}
+}
@@ -0,0 +1,221 @@
+package serialize
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DataRace is a data race reported by the race detector
+type DataRace struct {
+	// Accesses holds the conflicting memory accesses, the one that triggered the report first
+	Accesses []RaceAccess `json:"accesses"`
+	// Goroutines holds where the goroutines involved in the race were created
+	Goroutines []RaceGoroutine `json:"goroutines,omitempty"`
+	Report     string          `json:"report"`
+}
+
+// RaceAccess is a memory access involved in a data race
+type RaceAccess struct {
+	// Kind is how the race detector describes the access, e.g. "Write" or "Previous read"
+	Kind      string      `json:"kind"`
+	Address   string      `json:"address"`
+	Goroutine int64       `json:"goroutine"`
+	Stack     []RaceFrame `json:"stack"`
+	// Step is the index of the step where the access happened, -1 if no step matches it
+	Step int `json:"step"`
+}
+
+// RaceGoroutine is a goroutine involved in a data race
+type RaceGoroutine struct {
+	ID        int64       `json:"id"`
+	State     string      `json:"state"`
+	CreatedAt []RaceFrame `json:"createdAt"`
+}
+
+// RaceFrame is a single frame of a stack printed by the race detector
+type RaceFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+const (
+	_raceReportStart = "WARNING: DATA RACE"
+	_raceReportEnd   = "=================="
+)
+
+var (
+	raceAccessRegexp    = regexp.MustCompile(`^(.+) at (0x[0-9a-f]+) by (?:main goroutine|goroutine (\d+)):$`)
+	raceGoroutineRegexp = regexp.MustCompile(`^Goroutine (\d+) \((.+)\) created at:$`)
+	raceFileRegexp      = regexp.MustCompile(`^\s+(.+):(\d+)(?: \+0x[0-9a-f]+)?$`)
+)
+
+// raceReport is a data race along with the offset of its report in stderr
+type raceReport struct {
+	race   DataRace
+	offset int
+}
+
+// ParseRaceReports extracts the data races reported by the race detector in the program stderr
+func ParseRaceReports(stderr string) []DataRace {
+	var races []DataRace
+	for _, report := range parseRaceReports(stderr) {
+		races = append(races, report.race)
+	}
+	return races
+}
+
+func parseRaceReports(stderr string) []raceReport {
+	var reports []raceReport
+	var current *raceReport
+	var lines []string
+	// stack is where the frames of the current section are appended
+	var stack *[]RaceFrame
+	offset := 0
+	for line := range strings.Lines(stderr) {
+		lineOffset := offset
+		offset += len(line)
+		line = strings.TrimRight(line, "\n")
+		if strings.Contains(line, _raceReportStart) {
+			current = &raceReport{offset: lineOffset}
+			lines = []string{_raceReportStart}
+			stack = nil
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		if strings.HasSuffix(line, _raceReportEnd) {
+			current.race.Report = strings.Join(lines, "\n")
+			reports = append(reports, *current)
+			current = nil
+			continue
+		}
+		lines = append(lines, line)
+
+		if match := raceAccessRegexp.FindStringSubmatch(line); match != nil {
+			goroutine := int64(1) // the race detector names goroutine 1 "main goroutine"
+			if match[3] != "" {
+				goroutine, _ = strconv.ParseInt(match[3], 10, 64)
+			}
+			current.race.Accesses = append(current.race.Accesses, RaceAccess{Kind: match[1], Address: match[2], Goroutine: goroutine, Step: -1})
+			stack = &current.race.Accesses[len(current.race.Accesses)-1].Stack
+			continue
+		}
+		if match := raceGoroutineRegexp.FindStringSubmatch(line); match != nil {
+			id, _ := strconv.ParseInt(match[1], 10, 64)
+			current.race.Goroutines = append(current.race.Goroutines, RaceGoroutine{ID: id, State: match[2]})
+			stack = &current.race.Goroutines[len(current.race.Goroutines)-1].CreatedAt
+			continue
+		}
+		if stack == nil || strings.TrimSpace(line) == "" {
+			continue
+		}
+		if match := raceFileRegexp.FindStringSubmatch(line); match != nil && len(*stack) > 0 && (*stack)[len(*stack)-1].File == "" {
+			frame := &(*stack)[len(*stack)-1]
+			frame.File = match[1]
+			frame.Line, _ = strconv.Atoi(match[2])
+			continue
+		}
+		function := strings.TrimSpace(line)
+		if i := strings.LastIndex(function, "("); i > 0 {
+			function = function[:i]
+		}
+		*stack = append(*stack, RaceFrame{Function: function})
+	}
+	return reports
+}
+
+// AttachRaces parses the data races from the response stderr and links each of them to the steps
+// where its conflicting accesses happened, races attached by a previous call are replaced
+func AttachRaces(resp *ExecutionResponse) {
+	resp.Races = nil
+	for i := range resp.Steps {
+		resp.Steps[i].Races = nil
+	}
+	reports := parseRaceReports(resp.StdErr)
+	if len(reports) == 0 {
+		return
+	}
+	// stderrEnd[i] is the length of stderr once step i was recorded
+	stderrEnd := make([]int, len(resp.Steps))
+	written := 0
+	for i := range resp.Steps {
+		written += len(resp.Steps[i].StdErr)
+		stderrEnd[i] = written
+	}
+	for index, report := range reports {
+		// the report is printed right after the access that triggered it, so it shows up in the following step
+		reportedAt := len(resp.Steps) - 1
+		for i, end := range stderrEnd {
+			if report.offset < end {
+				reportedAt = i
+				break
+			}
+		}
+		searchUntil := reportedAt
+		attached := false
+		for i := range report.race.Accesses {
+			access := &report.race.Accesses[i]
+			access.Step = findAccessStep(resp.Steps, access, searchUntil)
+			if access.Step == -1 {
+				continue
+			}
+			searchUntil = access.Step
+			resp.Steps[access.Step].Races = append(resp.Steps[access.Step].Races, index)
+			attached = true
+		}
+		if !attached && reportedAt >= 0 {
+			resp.Steps[reportedAt].Races = append(resp.Steps[reportedAt].Races, index)
+		}
+		resp.Races = append(resp.Races, report.race)
+	}
+}
+
+// findAccessStep returns the last step up to until where the goroutine of the access was at the accessing line
+func findAccessStep(steps []Step, access *RaceAccess, until int) int {
+	var accessFrame *RaceFrame
+	for i := range access.Stack {
+		if isInMainDotGo(access.Stack[i].File) {
+			accessFrame = &access.Stack[i]
+			break
+		}
+	}
+	if accessFrame == nil {
+		return -1
+	}
+	for i := min(until, len(steps)-1); i >= 0; i-- {
+		for _, data := range steps[i].GoroutinesData {
+			if data.Goroutine == nil || data.Goroutine.ID != access.Goroutine {
+				continue
+			}
+			for _, frame := range data.Stacktrace {
+				if isInMainDotGo(frame.File) {
+					if frame.Line == accessFrame.Line {
+						return i
+					}
+					break
+				}
+			}
+		}
+	}
+	return -1
+}
+
+// describe tells the narrative the conflicting accesses of the data race
+func (race *DataRace) describe() string {
+	var accesses []string
+	for _, access := range race.Accesses {
+		detail := fmt.Sprintf("%s by goroutine %d", strings.ToLower(access.Kind), access.Goroutine)
+		for _, frame := range access.Stack {
+			if isInMainDotGo(frame.File) {
+				detail += fmt.Sprintf(" at line %d", frame.Line)
+				break
+			}
+		}
+		accesses = append(accesses, detail)
+	}
+	return "data race: " + strings.Join(accesses, " conflicts with ")
+}
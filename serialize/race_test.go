@@ -0,0 +1,71 @@
+package serialize
+
+import "testing"
+
+const _raceStderr = `==================
+WARNING: DATA RACE
+Read at 0x00c000012198 by goroutine 7:
+  main.main.func1()
+      /tmp/main.go:11 +0x2e
+
+Previous write at 0x00c000012198 by main goroutine:
+  main.main()
+      /tmp/main.go:13 +0xc4
+
+Goroutine 7 (running) created at:
+  main.main()
+      /tmp/main.go:10 +0xa4
+==================
+`
+
+func TestParseRaceReports(t *testing.T) {
+	races := ParseRaceReports("before\n" + _raceStderr + "Found 1 data race(s)\n")
+	if len(races) != 1 {
+		t.Fatalf("got %d races, want 1", len(races))
+	}
+	race := races[0]
+	if len(race.Accesses) != 2 {
+		t.Fatalf("got %d accesses, want 2", len(race.Accesses))
+	}
+	read, write := race.Accesses[0], race.Accesses[1]
+	if read.Kind != "Read" || read.Goroutine != 7 || read.Address != "0x00c000012198" {
+		t.Errorf("unexpected read access %+v", read)
+	}
+	if write.Kind != "Previous write" || write.Goroutine != 1 {
+		t.Errorf("unexpected write access %+v", write)
+	}
+	wantFrame := RaceFrame{Function: "main.main.func1", File: "/tmp/main.go", Line: 11}
+	if len(read.Stack) != 1 || read.Stack[0] != wantFrame {
+		t.Errorf("got read stack %+v, want [%+v]", read.Stack, wantFrame)
+	}
+	if len(race.Goroutines) != 1 || race.Goroutines[0].ID != 7 || race.Goroutines[0].State != "running" || race.Goroutines[0].CreatedAt[0].Line != 10 {
+		t.Errorf("unexpected goroutines %+v", race.Goroutines)
+	}
+}
+
+func TestAttachRaces(t *testing.T) {
+	steps := []Step{
+		newTestStep(1, "main.main", 10),
+		newTestStep(1, "main.main", 13),
+		newTestStep(7, "main.main.func1", 11),
+		newTestStep(1, "main.main", 14),
+	}
+	steps[3].StdErr = _raceStderr
+	resp := ExecutionResponse{Steps: steps, StdErr: _raceStderr}
+	AttachRaces(&resp)
+
+	if len(resp.Races) != 1 {
+		t.Fatalf("got %d races, want 1", len(resp.Races))
+	}
+	if got := resp.Races[0].Accesses[0].Step; got != 2 {
+		t.Errorf("read attached to step %d, want 2", got)
+	}
+	if got := resp.Races[0].Accesses[1].Step; got != 1 {
+		t.Errorf("write attached to step %d, want 1", got)
+	}
+	for i, want := range []int{0, 1, 1, 0} {
+		if len(resp.Steps[i].Races) != want {
+			t.Errorf("step %d has %d races, want %d", i, len(resp.Steps[i].Races), want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package serialize
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// processorStatuses names the states of a P, see _Pidle in the runtime
+var processorStatuses = []string{"idle", "running", "syscall", "gcstop", "dead"}
+
+// Scheduler is the state of the Go scheduler at a step in terms of the GMP model: the OS threads (M),
+// the processors (P) they hold and the goroutines (G) they run. The goroutines that aren't on a thread
+// are waiting or runnable.
+type Scheduler struct {
+	Threads    []ThreadState `json:"threads"`
+	Processors []Processor   `json:"processors"`
+}
+
+// ThreadState is an OS thread of the traced program
+type ThreadState struct {
+	ID int `json:"id"`
+	// Goroutine is the goroutine running on the thread, 0 when it runs none
+	Goroutine int64 `json:"goroutine,omitempty"`
+	// Processor is the ID of the P the thread holds, -1 when it holds none
+	Processor int    `json:"processor"`
+	Function  string `json:"function,omitempty"`
+	Line      int    `json:"line,omitempty"`
+}
+
+// Processor is a P of the scheduler, there are GOMAXPROCS of them
+type Processor struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+	// Thread is the ID of the thread holding the P, 0 when it's not held
+	Thread int `json:"thread,omitempty"`
+}
+
+// readScheduler lists the threads of the program and matches them with the processors held by their Ms
+func (v *Serializer) readScheduler(ctx context.Context) (*Scheduler, error) {
+	threads, err := v.client.ListThreads(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list threads: %w", err)
+	}
+	processors, err := v.readProcessors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newScheduler(threads, processors), nil
+}
+
+// newScheduler matches the threads with the processors they hold, the threads are sorted by ID
+func newScheduler(threads []*api.Thread, processors []Processor) *Scheduler {
+	scheduler := &Scheduler{Processors: processors}
+	for _, thread := range threads {
+		state := ThreadState{ID: thread.ID, Goroutine: thread.GoroutineID, Processor: -1, Line: thread.Line}
+		if thread.Function != nil {
+			state.Function = thread.Function.Name()
+		}
+		for _, processor := range processors {
+			if processor.Thread == thread.ID {
+				state.Processor = processor.ID
+			}
+		}
+		scheduler.Threads = append(scheduler.Threads, state)
+	}
+	slices.SortFunc(scheduler.Threads, func(a, b ThreadState) int { return a.ID - b.ID })
+	return scheduler
+}
+
+// processorStatus names the status of a P, "unknown" for statuses added by later Go versions
+func processorStatus(status uint64) string {
+	if status < uint64(len(processorStatuses)) {
+		return processorStatuses[status]
+	}
+	return "unknown"
+}
+
+// readProcessors reads the Ps from runtime.allp, the thread holding a P is the procid of its M
+func (v *Serializer) readProcessors(ctx context.Context) ([]Processor, error) {
+	count, err := v.evalUint(ctx, "len(runtime.allp)")
+	if err != nil {
+		return nil, err
+	}
+	processors := make([]Processor, 0, count)
+	for i := range count {
+		p := fmt.Sprintf("runtime.allp[%d]", i)
+		id, err := v.evalUint(ctx, p+".id")
+		if err != nil {
+			return nil, err
+		}
+		status, err := v.evalUint(ctx, p+".status")
+		if err != nil {
+			return nil, err
+		}
+		processor := Processor{ID: int(id), Status: processorStatus(status)}
+		m, err := v.evalUint(ctx, p+".m")
+		if err != nil {
+			return nil, err
+		}
+		if m != 0 {
+			procid, err := v.evalUint(ctx, "(*runtime.m)("+strconv.FormatUint(m, 10)+").procid")
+			if err != nil {
+				return nil, err
+			}
+			processor.Thread = int(procid)
+		}
+		processors = append(processors, processor)
+	}
+	return processors, nil
+}
@@ -0,0 +1,53 @@
+package serialize
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+func TestNewScheduler(t *testing.T) {
+	threads := []*api.Thread{
+		{ID: 1203, Line: 435, Function: &api.Function{Name_: "runtime.futex"}},
+		{ID: 1200, GoroutineID: 1, Line: 12, Function: &api.Function{Name_: "main.main"}},
+		{ID: 1201, GoroutineID: 6, Line: 7, Function: &api.Function{Name_: "main.worker"}},
+		{ID: 1202},
+	}
+	processors := []Processor{
+		{ID: 0, Status: "running", Thread: 1200},
+		{ID: 1, Status: "running", Thread: 1201},
+		{ID: 2, Status: "idle"},
+	}
+	want := &Scheduler{
+		Threads: []ThreadState{
+			{ID: 1200, Goroutine: 1, Processor: 0, Function: "main.main", Line: 12},
+			{ID: 1201, Goroutine: 6, Processor: 1, Function: "main.worker", Line: 7},
+			{ID: 1202, Processor: -1},
+			{ID: 1203, Processor: -1, Function: "runtime.futex", Line: 435},
+		},
+		Processors: processors,
+	}
+	if got := newScheduler(threads, processors); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestProcessorStatus(t *testing.T) {
+	tests := []struct {
+		status uint64
+		want   string
+	}{
+		{status: 0, want: "idle"},
+		{status: 1, want: "running"},
+		{status: 2, want: "syscall"},
+		{status: 3, want: "gcstop"},
+		{status: 4, want: "dead"},
+		{status: 5, want: "unknown"},
+	}
+	for _, tt := range tests {
+		if got := processorStatus(tt.status); got != tt.want {
+			t.Errorf("processorStatus(%d) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
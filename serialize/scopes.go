@@ -0,0 +1,193 @@
+package serialize
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"sort"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// VariableScope tells where a local variable is visible and whether it hides or is hidden by another variable
+type VariableScope struct {
+	VariableFrame
+	Name     string `json:"name"`
+	DeclLine int64  `json:"declLine,omitempty"`
+	// BlockStart and BlockEnd are the lines of the block declaring the variable, e.g. the body of a function,
+	// or the whole statement for the variables declared by if, for and switch statements, 0 when it's unknown
+	BlockStart int `json:"blockStart,omitempty"`
+	BlockEnd   int `json:"blockEnd,omitempty"`
+	// InScope is set when the frame's line is in the block and after the declaration
+	InScope bool `json:"inScope"`
+	// Shadowed is set when an inner variable of the same name hides the variable at the frame's line
+	Shadowed bool `json:"shadowed,omitempty"`
+	// Shadows is the DeclLine of the outer variable of the same name the variable hides, 0 when it hides none
+	Shadows int64 `json:"shadows,omitempty"`
+}
+
+// scopeDecl is a variable declared in a function of a source file
+type scopeDecl struct {
+	name       string
+	line       int
+	blockStart int
+	blockEnd   int
+	// shadows is the declaration line of the outer variable the declaration hides
+	shadows int
+}
+
+// contains checks if the line is in the declaring block
+func (d scopeDecl) contains(line int) bool {
+	return d.blockStart <= line && line <= d.blockEnd
+}
+
+// AnnotateScopes sets Scopes on every step to the block scope of the arguments and locals of the frames
+// compared by AnnotateChanges, read from the source files of the frames
+func AnnotateScopes(steps []Step) {
+	files := map[string][]scopeDecl{}
+	declsOf := func(file string) []scopeDecl {
+		decls, ok := files[file]
+		if !ok {
+			src, err := os.ReadFile(file)
+			if err == nil {
+				decls, _ = parseScopes(file, src)
+			}
+			files[file] = decls
+		}
+		return decls
+	}
+	for i := range steps {
+		step := &steps[i]
+		step.Scopes = nil
+		forEachFrame(step, func(at variableFrame, vars []api.Variable) {
+			// package variables are always in scope
+			if at.Goroutine == 0 {
+				return
+			}
+			step.Scopes = append(step.Scopes, frameScopes(at.VariableFrame, at.line, vars, declsOf(at.file))...)
+		})
+	}
+}
+
+// frameScopes matches the variables of a frame stopped at the line to their declarations
+func frameScopes(at VariableFrame, line int, vars []api.Variable, decls []scopeDecl) []VariableScope {
+	scopes := make([]VariableScope, 0, len(vars))
+	for _, variable := range vars {
+		scope := VariableScope{VariableFrame: at, Name: variable.Name, DeclLine: variable.DeclLine}
+		scope.Shadowed = variable.Flags&api.VariableShadowed != 0
+		scope.InScope = true
+		if decl, ok := findDecl(decls, variable.Name, int(variable.DeclLine), line); ok {
+			scope.BlockStart, scope.BlockEnd = decl.blockStart, decl.blockEnd
+			scope.Shadows = int64(decl.shadows)
+			// arguments are declared on the function's line and visible from it
+			afterDecl := line > decl.line || variable.Flags&(api.VariableArgument|api.VariableReturnArgument) != 0
+			scope.InScope = decl.contains(line) && afterDecl
+		}
+		scopes = append(scopes, scope)
+	}
+	// delve only flags the hidden variable when both are visible to it, the source tells it otherwise
+	for i := range scopes {
+		for j := range scopes {
+			if i != j && scopes[i].Name == scopes[j].Name && scopes[j].InScope && scopes[j].Shadows != 0 && scopes[j].Shadows == scopes[i].DeclLine {
+				scopes[i].Shadowed = true
+			}
+		}
+	}
+	return scopes
+}
+
+// findDecl finds the declaration of the variable, by its declaration line or else as the innermost
+// declaration of the name whose block contains the line
+func findDecl(decls []scopeDecl, name string, declLine, line int) (scopeDecl, bool) {
+	var found scopeDecl
+	ok := false
+	for _, decl := range decls {
+		if decl.name != name {
+			continue
+		}
+		if decl.line == declLine {
+			return decl, true
+		}
+		if decl.contains(line) && (!ok || decl.blockStart > found.blockStart) {
+			found, ok = decl, true
+		}
+	}
+	return found, ok
+}
+
+// parseScopes lists the variables declared in the functions of the source with their declaring blocks
+func parseScopes(file string, src []byte) ([]scopeDecl, error) {
+	fset, pkg, info, err := checkSource(file, src)
+	if err != nil {
+		return nil, err
+	}
+
+	var decls []scopeDecl
+	for ident, obj := range info.Defs {
+		variable, ok := obj.(*types.Var)
+		if !ok || variable.IsField() || variable.Parent() == nil || variable.Parent() == pkg.Scope() {
+			continue
+		}
+		block := variable.Parent()
+		decl := scopeDecl{
+			name:       ident.Name,
+			line:       fset.Position(ident.Pos()).Line,
+			blockStart: fset.Position(block.Pos()).Line,
+			blockEnd:   fset.Position(block.End()).Line,
+		}
+		if _, outer := block.Parent().LookupParent(ident.Name, ident.Pos()); outer != nil {
+			if outerVar, ok := outer.(*types.Var); ok && outerVar.Parent() != types.Universe {
+				decl.shadows = fset.Position(outerVar.Pos()).Line
+			}
+		}
+		decls = append(decls, decl)
+	}
+	sort.Slice(decls, func(i, j int) bool { return decls[i].line < decls[j].line })
+	return decls, nil
+}
+
+// checkSource type checks the source file on its own, the imports aren't resolved so the objects
+// using imported packages have invalid types but the declarations and scopes are all there
+func checkSource(file string, src []byte) (*token.FileSet, *types.Package, *types.Info, error) {
+	fset := token.NewFileSet()
+	parsed, err := parser.ParseFile(fset, file, src, 0)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("parse source: %w", err)
+	}
+	info := &types.Info{Defs: map[*ast.Ident]types.Object{}}
+	conf := types.Config{
+		Importer: noImporter{},
+		Error:    func(error) {},
+	}
+	pkg, _ := conf.Check(parsed.Name.Name, fset, []*ast.File{parsed}, info)
+	return fset, pkg, info, nil
+}
+
+// noImporter fails every import, the type checker carries on with the imported names unresolved
+type noImporter struct{}
+
+func (noImporter) Import(path string) (*types.Package, error) {
+	return nil, errors.New("imports are not resolved")
+}
+
+// shadowDetails describes the variables created in the current frame at the step that hide an outer variable
+func shadowDetails(step *Step) []string {
+	goroutine := step.GoroutinesData[0].Goroutine.ID
+	created := map[string]bool{}
+	for _, change := range step.Changes {
+		if change.Kind == VariableCreated && change.Goroutine == goroutine && change.Frame == 0 {
+			created[fmt.Sprintf("%s:%d", change.Name, change.DeclLine)] = true
+		}
+	}
+	var details []string
+	for _, scope := range step.Scopes {
+		if scope.Shadows != 0 && scope.Goroutine == goroutine && scope.Frame == 0 && created[fmt.Sprintf("%s:%d", scope.Name, scope.DeclLine)] {
+			details = append(details, fmt.Sprintf("%s declared at line %d shadows the %s declared at line %d", scope.Name, scope.DeclLine, scope.Name, scope.Shadows))
+		}
+	}
+	return details
+}
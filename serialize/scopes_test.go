@@ -0,0 +1,74 @@
+package serialize
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+const _shadowSource = `package main
+
+import "fmt"
+
+func main() {
+	x, err := 1, error(nil)
+	if x > 0 {
+		x, err := fmt.Println(x)
+		_, _ = x, err
+	}
+	for i := range 2 {
+		_ = i
+	}
+}
+`
+
+func TestParseScopes(t *testing.T) {
+	decls, err := parseScopes("main.go", []byte(_shadowSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []scopeDecl{
+		{name: "x", line: 6, blockStart: 5, blockEnd: 14},
+		{name: "err", line: 6, blockStart: 5, blockEnd: 14},
+		{name: "x", line: 8, blockStart: 7, blockEnd: 10, shadows: 6},
+		{name: "err", line: 8, blockStart: 7, blockEnd: 10, shadows: 6},
+		{name: "i", line: 11, blockStart: 11, blockEnd: 13},
+	}
+	if len(decls) != len(want) {
+		t.Fatalf("got %+v, want %+v", decls, want)
+	}
+	for _, decl := range want {
+		found := false
+		for _, got := range decls {
+			found = found || got == decl
+		}
+		if !found {
+			t.Errorf("%+v not found in %+v", decl, decls)
+		}
+	}
+}
+
+func TestFrameScopes(t *testing.T) {
+	decls, err := parseScopes("main.go", []byte(_shadowSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	outer, inner := intVar("x", "1"), intVar("x", "2")
+	outer.DeclLine, inner.DeclLine = 6, 8
+	// neither variable is flagged by delve, the source tells which one is hidden
+	at := VariableFrame{Goroutine: 1, Function: "main.main"}
+	got := frameScopes(at, 9, []api.Variable{outer, inner}, decls)
+	want := []VariableScope{
+		{VariableFrame: at, Name: "x", DeclLine: 6, BlockStart: 5, BlockEnd: 14, InScope: true, Shadowed: true},
+		{VariableFrame: at, Name: "x", DeclLine: 8, BlockStart: 7, BlockEnd: 10, InScope: true, Shadows: 6},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	got = frameScopes(at, 12, []api.Variable{inner}, decls)
+	if got[0].InScope {
+		t.Errorf("x of the if block is in scope in the loop: %+v", got[0])
+	}
+}
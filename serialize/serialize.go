@@ -5,7 +5,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"runtime"
+	"slices"
 	"strings"
 	"time"
 
@@ -15,6 +18,11 @@ import (
 	"github.com/go-delve/delve/service/api"
 )
 
+const (
+	_stdoutPath = "output/stdout.log"
+	_stderrPath = "output/stderr.log"
+)
+
 var errNoMain = errors.New("main function not found")
 var defaultLoadConfig = api.LoadConfig{
 	FollowPointers:     true,
@@ -24,67 +32,342 @@ var defaultLoadConfig = api.LoadConfig{
 	MaxArrayValues:     10,
 }
 
+// Options controls what the serializer records in addition to the execution steps
+type Options struct {
+	// Stats adds line hit counts and function call counts to the response
+	Stats bool
+	// CallTree adds the tree of function calls to the response
+	CallTree bool
+	// CollapseLoops keeps only the first LoopHead and the last LoopTail iterations of every loop in full
+	CollapseLoops bool
+	LoopHead      int
+	LoopTail      int
+	// LoopsUnderLimit doesn't count the steps of the loop iterations past LoopHead against the steps limit,
+	// it's implied by CollapseLoops and set on its own when the loops are collapsed once recorded
+	LoopsUnderLimit bool
+	// StepInto lists the standard library packages whose frames are recorded like user code, e.g. "sort"
+	StepInto []string
+	// Load bounds how much of every variable is loaded, variables cut off by it are listed in Step.Truncated when Truncated is set
+	Load LoadLimits
+	// MemStats records the heap and GC statistics at every MemStats-th step, 0 disables them
+	MemStats int
+	// Expand, when set, asks for a variable to be loaded again instead of the steps, see ExpandVariable
+	Expand *ExpandRequest
+	// Scheduler records the OS threads at every step with the processors they hold and the goroutines they run
+	Scheduler bool
+	// Disassemble records the machine code of the functions in main.go, each step references the instructions of its line
+	Disassemble bool
+	// Deterministic fixes the random seed of the runtime, so the map iteration order and the scheduler's choices
+	// repeat between runs. The program should also run with GOMAXPROCS=1 and be built with -tags=faketime.
+	Deterministic bool
+	// Diagnostics are the compiler diagnostics of the program, added to the response and attached to the steps of their lines
+	Diagnostics []CompilerDiagnostic
+	// Slices records the slice headers held by the variables, grouped by backing array, see AnnotateSlices
+	Slices bool
+	// Closures decodes the function values held by the variables into their function and captured variables
+	Closures bool
+	// Truncated lists the variables cut off by the load limits on every step, see ExpandVariable
+	Truncated bool
+	// Scopes records the declaring block of the locals, whether they are in scope and the variables they shadow
+	Scopes bool
+	// Interfaces records the dynamic type, nil state and implemented methods of the interface values
+	Interfaces bool
+	// Formatted shows the values of the types with a formatter, built in or declared in the source, as a list, a tree or text
+	Formatted bool
+}
+
 type Serializer struct {
 	client *gateway.Debug
 	logger zerolog.Logger
+	opts   Options
+	// loadConfig is the load config of the variables recorded in the steps
+	loadConfig api.LoadConfig
+
+	// stdoutOffset and stderrOffset track how much of the output files was already attached to steps
+	stdoutOffset int64
+	stderrOffset int64
+	// leaks is set once main.main is about to return
+	leaks []LeakedGoroutine
+	// atMainReturn reports whether the last step taken stopped just before main.main returns
+	atMainReturn bool
+	// defers holds the pending deferred calls of every goroutine the last time a step was built
+	defers map[int64][]pendingDefer
+	// deferBreakpoints holds the breakpoints set by armDeferBreakpoints by goroutine and address
+	deferBreakpoints map[int64]map[uint64]string
+	deferArguments   map[int64]map[deferKey][]api.Variable
+	upcomingDefers   map[int64]upcomingDefer
+	deferStatements  map[string]map[int]deferStatement
+	// metadata describes the run, the output of faketime runs is stripped of its playback headers by the decoders
+	metadata       Metadata
+	stdoutPlayback playbackDecoder
+	stderrPlayback playbackDecoder
+	// disassembly holds the instructions of the functions disassembled so far, see Options.Disassemble
+	disassembly map[string][]Instruction
+	// goRoots are the Go roots the standard library packages stepped into are read from, gotutor's own
+	// and the one the program was built with
+	goRoots []string
 }
 
-func NewSerializer(client *gateway.Debug, logger zerolog.Logger) *Serializer {
+func NewSerializer(client *gateway.Debug, logger zerolog.Logger, opts Options) *Serializer {
 	return &Serializer{
 		client: client,
 		logger: logger,
+		opts:   opts,
+
+		loadConfig: opts.Load.loadConfig(),
+
+		defers:           map[int64][]pendingDefer{},
+		deferBreakpoints: map[int64]map[uint64]string{},
+		deferArguments:   map[int64]map[deferKey][]api.Variable{},
+		upcomingDefers:   map[int64]upcomingDefer{},
+		deferStatements:  map[string]map[int]deferStatement{},
+		disassembly:      map[string][]Instruction{},
+		goRoots:          []string{runtime.GOROOT()},
 	}
 }
 
 func (v *Serializer) ExecutionSteps(ctx context.Context, limit int) (ExecutionResponse, error) {
 	start := time.Now()
-	stepsSoFar := 0
-	err := v.initMainBreakPoint(ctx)
+	debugState, err := v.start(ctx)
 	if err != nil {
 		return ExecutionResponse{}, err
 	}
-	debugState, err := v.client.Continue(ctx)
-	if err != nil {
-		return ExecutionResponse{}, fmt.Errorf("main goroutine: continue")
-	}
 
 	if debugState.Exited {
 		return ExecutionResponse{}, nil
 	}
+	v.metadata, err = v.readMetadata(ctx, limit)
+	if err != nil {
+		v.warnRuntimeVariables(err, "failed to read the run metadata")
+	}
+
+	loops, err := v.loopCounter(debugState)
+	if err != nil {
+		return ExecutionResponse{}, fmt.Errorf("collapse loops: %w", err)
+	}
 
 	var allSteps []Step
-	for ctx.Err() == nil {
-		stepsSoFar++
-		if stepsSoFar >= limit {
-			return ExecutionResponse{Steps: allSteps, Duration: time.Since(start).String()}, fmt.Errorf("%d limit reached", limit)
-		}
-		step, exited, err := v.goToNextLine(ctx, debugState.SelectedGoroutine)
+	reachedLimit, err := recordSteps(ctx, limit, v.nextStop(debugState.SelectedGoroutine), loops, func(_ int, step *Step) (bool, error) {
+		err := v.attachOutput(step)
 		if err != nil {
-			return ExecutionResponse{Steps: allSteps}, err
+			return true, err
+		}
+		if v.opts.MemStats > 0 && len(allSteps)%v.opts.MemStats == 0 {
+			step.MemStats, err = v.readMemStats(ctx)
+			if err != nil {
+				v.warnRuntimeVariables(err, "failed to read memory stats, not recording them")
+				v.opts.MemStats = 0
+			}
 		}
-		if step.isValid() {
-			allSteps = append(allSteps, step)
+		if v.metadata.Faketime {
+			virtualTime, err := v.readVirtualTime(ctx)
+			if err != nil {
+				return true, fmt.Errorf("read virtual time: %w", err)
+			}
+			step.VirtualTime = &virtualTime
 		}
-		if exited {
-			break
+		if v.opts.Scheduler {
+			step.Scheduler, err = v.readScheduler(ctx)
+			if err != nil {
+				v.warnRuntimeVariables(err, "failed to read the scheduler state, not recording it")
+				v.opts.Scheduler = false
+			}
 		}
+		if v.opts.Disassemble {
+			err = v.attachAssembly(ctx, step)
+			if err != nil {
+				return true, err
+			}
+		}
+		allSteps = append(allSteps, *step)
+		return false, nil
+	})
+	if err != nil {
+		return ExecutionResponse{Steps: allSteps}, err
 	}
-	stdout, err := os.ReadFile("output/stdout.log")
+	// the steps recorded up to the limit are still returned, with their loops collapsed
+	var limitErr error
+	if reachedLimit {
+		limitErr = fmt.Errorf("%d limit reached", limit)
+	}
+	stdout, err := os.ReadFile(_stdoutPath)
 	if err != nil {
 		return ExecutionResponse{}, fmt.Errorf("read stdout: %w", err)
 	}
-	stderr, err := os.ReadFile("output/stderr.log")
+	stderr, err := os.ReadFile(_stderrPath)
 	if err != nil {
 		return ExecutionResponse{}, fmt.Errorf("read stderr: %w", err)
 	}
-	return ExecutionResponse{
+	response := ExecutionResponse{
 		Steps:       allSteps,
 		Duration:    time.Since(start).String(),
 		StdOut:      string(stdout),
 		StdErr:      string(stderr),
 		StdOutBytes: stdout,
 		StdErrBytes: stderr,
-	}, nil
+		Leaks:       v.leaks,
+		Diagnostics: v.opts.Diagnostics,
+		Metadata:    &v.metadata,
+	}
+	if v.metadata.Faketime {
+		response.StdOut = string(decodePlayback(stdout))
+		response.StdErr = string(decodePlayback(stderr))
+	}
+	if v.opts.Disassemble {
+		response.Disassembly = v.disassembly
+	}
+	AnnotateChanges(response.Steps)
+	if v.opts.Slices {
+		AnnotateSlices(response.Steps)
+	}
+	if v.opts.Closures {
+		AnnotateClosures(response.Steps)
+	}
+	if v.opts.Truncated {
+		AnnotateTruncated(response.Steps)
+	}
+	if v.opts.Scopes {
+		AnnotateScopes(response.Steps)
+	}
+	if v.opts.Interfaces {
+		AnnotateInterfaces(response.Steps)
+	}
+	if v.opts.Formatted {
+		AnnotateFormatted(response.Steps, v.formatters(response.Steps))
+	}
+	AttachRaces(&response)
+	AttachDiagnostics(&response)
+	if v.opts.Stats {
+		stats := ComputeStats(allSteps)
+		response.Stats = &stats
+	}
+	if v.opts.CallTree {
+		// built before collapsing the loops so the calls made in the collapsed iterations are kept
+		response.CallTree = BuildCallTree(response.Steps)
+	}
+	if v.opts.CollapseLoops && len(allSteps) > 0 {
+		src, err := os.ReadFile(allSteps[0].GoroutinesData[0].Goroutine.CurrentLoc.File)
+		if err != nil {
+			return ExecutionResponse{}, fmt.Errorf("read source: %w", err)
+		}
+		err = CollapseLoops(&response, src, v.opts.LoopHead, v.opts.LoopTail)
+		if err != nil {
+			return ExecutionResponse{}, fmt.Errorf("collapse loops: %w", err)
+		}
+	}
+	return response, limitErr
+}
+
+// nextStop steps the program to its next stop, atMainReturn is set when it stopped just before main.main returns
+type nextStop func(ctx context.Context) (step Step, atMainReturn bool, exited bool, err error)
+
+// nextStop steps to the next line of the given goroutine, see goToNextLine
+func (v *Serializer) nextStop(goroutine *api.Goroutine) nextStop {
+	return func(ctx context.Context) (Step, bool, bool, error) {
+		step, exited, err := v.goToNextLine(ctx, goroutine)
+		return step, v.atMainReturn, exited, err
+	}
+}
+
+// _uncountedStopsFactor caps the stops which don't count against the limit, so a loop running forever
+// still ends the trace when the loops are collapsed
+const _uncountedStopsFactor = 10
+
+// recordSteps steps through the program and calls record with every stop recorded as a step along with its index
+// in the trace, the stops without a valid step and the repeated stop at the return of main.main are skipped.
+// ExecutionSteps and ExpandVariable both step with it so the indexes of ExpandRequest.Step match the trace.
+// It stops when the program exits, the context is done, record returns done or the limit of stops is reached.
+// The steps in the iterations of loops past their head don't count against the limit when loops is set.
+func recordSteps(ctx context.Context, limit int, next nextStop, loops *loopCounter, record func(index int, step *Step) (done bool, err error)) (reachedLimit bool, err error) {
+	var last []Step
+	recorded := 0
+	counted := 1
+	for stops := 1; ctx.Err() == nil; stops++ {
+		if counted >= limit || stops >= limit*_uncountedStopsFactor {
+			return true, nil
+		}
+		step, atMainReturn, exited, err := next(ctx)
+		if err != nil {
+			return false, err
+		}
+		counted++
+		if step.isValid() && !(atMainReturn && repeatsLastStep(last, &step)) {
+			done, err := record(recorded, &step)
+			if done || err != nil {
+				return false, err
+			}
+			recorded++
+			last = []Step{step}
+			if loops.pastHead(&step) {
+				counted--
+			}
+		}
+		if exited {
+			return false, nil
+		}
+	}
+	return false, nil
+}
+
+// loopCounter returns the counter of the loops of the traced source for recordSteps, nil unless the loops are collapsed
+func (v *Serializer) loopCounter(debugState *api.DebuggerState) (*loopCounter, error) {
+	if !(v.opts.CollapseLoops || v.opts.LoopsUnderLimit) || debugState.SelectedGoroutine == nil {
+		return nil, nil
+	}
+	src, err := os.ReadFile(debugState.SelectedGoroutine.CurrentLoc.File)
+	if err != nil {
+		return nil, fmt.Errorf("read source: %w", err)
+	}
+	return newLoopCounter(src, v.opts.LoopHead)
+}
+
+// formatters returns the built-in formatters along with the ones declared in the traced source
+func (v *Serializer) formatters(steps []Step) *Formatters {
+	formatters := NewFormatters()
+	file := tracedSource(steps)
+	if file == "" {
+		return formatters
+	}
+	src, err := os.ReadFile(file)
+	if err != nil {
+		v.logger.Debug().Err(err).Str("file", file).Msg("read format directives")
+		return formatters
+	}
+	if err := formatters.RegisterDirectives(src); err != nil {
+		v.logger.Warn().Err(err).Msg("invalid format directive")
+	}
+	return formatters
+}
+
+// start runs the program to the first line of main.main
+func (v *Serializer) start(ctx context.Context) (*api.DebuggerState, error) {
+	v.client.SetReturnValuesLoadConfig(&v.loadConfig)
+	if v.opts.Deterministic {
+		err := v.fixRandomSeed(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("fix random seed: %w", err)
+		}
+	}
+	err := v.initMainBreakPoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = v.initMainReturnBreakPoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+	debugState, err := v.client.Continue(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("main goroutine: continue")
+	}
+	if len(v.opts.StepInto) > 0 && !debugState.Exited && debugState.SelectedGoroutine != nil {
+		stacktrace, err := v.client.Stacktrace(ctx, debugState.SelectedGoroutine.ID, 100, 0, nil)
+		if err != nil {
+			return nil, fmt.Errorf("main goroutine: stacktrace: %w", err)
+		}
+		v.goRoots = append(v.goRoots, goRootOf(stacktrace))
+	}
+	return debugState, nil
 }
 
 func (v *Serializer) initMainBreakPoint(ctx context.Context) error {
@@ -115,7 +398,7 @@ func (v *Serializer) goToNextLine(ctx context.Context, goroutine *api.Goroutine)
 		if debugState.Exited {
 			return Step{}, true, nil
 		}
-	} else if isInMainDotGo(debugState.SelectedGoroutine.CurrentLoc.File) {
+	} else if v.isRecorded(debugState.SelectedGoroutine.CurrentLoc) {
 		debugState, err = v.client.Step(ctx)
 		if err != nil {
 			return Step{}, true, fmt.Errorf("step: %w", err)
@@ -151,8 +434,22 @@ func (v *Serializer) goToNextLine(ctx context.Context, goroutine *api.Goroutine)
 			return Step{}, true, nil
 		}
 	}
-	// if not in user code, don't build the step
-	if !isInMainDotGo(debugState.SelectedGoroutine.CurrentLoc.File) {
+	if isFatalThrow(debugState) {
+		step, err := v.buildFatalStep(ctx, debugState)
+		if err != nil {
+			return Step{}, true, fmt.Errorf("building fatal error step: %w", err)
+		}
+		return step, true, nil
+	}
+	v.atMainReturn = isMainReturn(debugState)
+	if v.atMainReturn {
+		v.leaks, err = v.leakedGoroutines(ctx)
+		if err != nil {
+			return Step{}, true, fmt.Errorf("leaked goroutines: %w", err)
+		}
+	}
+	// if not in user code or a library the user steps into, don't build the step
+	if !v.isRecorded(debugState.SelectedGoroutine.CurrentLoc) {
 		return Step{}, false, nil
 	}
 
@@ -167,16 +464,24 @@ func (v *Serializer) buildStep(ctx context.Context, debugState *api.DebuggerStat
 
 	packageVars, err := v.client.ListPackageVariables(ctx,
 		"^main.",
-		defaultLoadConfig,
+		v.loadConfig,
 	)
 	if err != nil {
 		return Step{}, fmt.Errorf("ListPackageVariables: %w", err)
 	}
 
-	stacktrace, err := v.client.Stacktrace(ctx, debugState.SelectedGoroutine.ID, 100, 0, &defaultLoadConfig)
+	stacktrace, err := v.client.Stacktrace(ctx, debugState.SelectedGoroutine.ID, 100, api.StacktraceReadDefers, &v.loadConfig)
 	if err != nil {
 		return Step{}, fmt.Errorf("stacktrace: %w", err)
 	}
+	defers := v.readDefers(debugState.SelectedGoroutine.ID, stacktrace)
+	deferredCall := startedDefer(v.defers[debugState.SelectedGoroutine.ID], defers, stacktrace)
+	v.defers[debugState.SelectedGoroutine.ID] = defers
+	err = v.armDeferBreakpoints(ctx, debugState.SelectedGoroutine.ID, defers)
+	if err != nil {
+		return Step{}, fmt.Errorf("arm defer breakpoints: %w", err)
+	}
+	v.prepareDeferArguments(ctx, debugState.SelectedGoroutine.ID, stacktrace)
 
 	goroutines, err := v.getAllGoroutines(ctx)
 	if err != nil {
@@ -184,27 +489,87 @@ func (v *Serializer) buildStep(ctx context.Context, debugState *api.DebuggerStat
 	}
 
 	goroutinesData := []GoRoutineData{{ // we want to make the current goroutine the first one
-		Goroutine:  debugState.SelectedGoroutine,
-		Stacktrace: stacktrace,
+		Goroutine:     debugState.SelectedGoroutine,
+		Stacktrace:    stacktrace,
+		LibraryFrames: v.libraryFrames(stacktrace),
+		Defers:        deferredCalls(defers),
 	}}
 	goroutines = removeGorotine(goroutines, debugState.SelectedGoroutine)
 	for _, goroutine := range goroutines {
-		stacktrace, err := v.client.Stacktrace(ctx, goroutine.ID, 100, 0, &defaultLoadConfig)
+		// the defers are only read for the goroutine being stepped, reading them is costly
+		stacktrace, err := v.client.Stacktrace(ctx, goroutine.ID, 100, 0, &v.loadConfig)
 		if err != nil {
 			return Step{}, fmt.Errorf("goroutine: %d, stacktrace: %w", goroutine.ID, err)
 		}
 		goroutinesData = append(goroutinesData, GoRoutineData{
-			Goroutine:  goroutine,
-			Stacktrace: stacktrace,
+			Goroutine:     goroutine,
+			Stacktrace:    stacktrace,
+			LibraryFrames: v.libraryFrames(stacktrace),
 		})
 	}
 
+	var returnValues []api.Variable
+	if debugState.CurrentThread != nil {
+		returnValues = debugState.CurrentThread.ReturnValues
+	}
+
 	return Step{
 		PackageVariables: packageVars,
 		GoroutinesData:   goroutinesData,
+		ReturnValues:     returnValues,
+		DeferredCall:     deferredCall,
 	}, nil
 }
 
+// attachOutput sets the output written by the program since the last step on the given step
+func (v *Serializer) attachOutput(step *Step) error {
+	stdout, err := readFrom(_stdoutPath, &v.stdoutOffset)
+	if err != nil {
+		return fmt.Errorf("read stdout: %w", err)
+	}
+	stderr, err := readFrom(_stderrPath, &v.stderrOffset)
+	if err != nil {
+		return fmt.Errorf("read stderr: %w", err)
+	}
+	if v.metadata.Faketime {
+		stdout = v.stdoutPlayback.decode(stdout)
+		stderr = v.stderrPlayback.decode(stderr)
+	}
+	step.StdOut = string(stdout)
+	step.StdErr = string(stderr)
+	return nil
+}
+
+// readFrom reads the file content starting at offset and advances offset past what was read
+func readFrom(path string, offset *int64) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	_, err = file.Seek(*offset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	*offset += int64(len(content))
+	return content, nil
+}
+
+// repeatsLastStep checks if the step is at the same line of the same goroutine as the last recorded step
+func repeatsLastStep(steps []Step, step *Step) bool {
+	if len(steps) == 0 {
+		return false
+	}
+	last := steps[len(steps)-1].GoroutinesData[0].Goroutine
+	current := step.GoroutinesData[0].Goroutine
+	return last.ID == current.ID && equalLocation(last.CurrentLoc, current.CurrentLoc)
+}
+
 func removeGorotine(goroutines []*api.Goroutine, goroutine *api.Goroutine) []*api.Goroutine {
 	var filteredGoroutines []*api.Goroutine
 	for _, g := range goroutines {
@@ -247,7 +612,7 @@ func (v *Serializer) isInvokingGoroutine(filePath string, line int) (bool, error
 }
 
 func (v *Serializer) continueToUserCode(ctx context.Context, debugState *api.DebuggerState) (*api.DebuggerState, bool, error) {
-	if isInMainDotGo(debugState.SelectedGoroutine.CurrentLoc.File) {
+	if v.isRecorded(debugState.SelectedGoroutine.CurrentLoc) {
 		return debugState, false, nil
 	}
 	v.logger.Debug().Msg(fmt.Sprintf("goroutine: %d, continue to user code", debugState.SelectedGoroutine.ID))
@@ -292,27 +657,44 @@ func (v *Serializer) continueToFirstFrameInMainDotGo(ctx context.Context, debugS
 	if err != nil {
 		return nil, true, fmt.Errorf("goroutine: %d, get stacktrace: %w", debugState.SelectedGoroutine.ID, err)
 	}
+	breakpoints, err := v.client.ListBreakpoints(ctx)
+	if err != nil {
+		return nil, true, fmt.Errorf("list breakpoints: %w", err)
+	}
 	var breakPointName string
+	// found is also set when another breakpoint already stops at the line
+	var found bool
 	for _, frame := range stack {
-		if strings.HasSuffix(frame.Location.File, "main.go") {
+		if strings.HasSuffix(frame.Location.File, "main.go") || v.isLibraryCode(frame.Location) {
 			nextLine, err := v.getNextLine(frame.Location.File, frame.Location.Line)
 			if err != nil {
 				return nil, true, fmt.Errorf("goroutine: %d, get next line: %w", debugState.SelectedGoroutine.ID, err)
 			}
-			breakPointName = fmt.Sprintf("gID%dL%d", debugState.SelectedGoroutine.ID, nextLine)
+			locations, err := v.client.FindLocation(ctx, api.EvalScope{GoroutineID: -1}, fmt.Sprintf("%s:%d", frame.Location.File, nextLine))
+			if err != nil {
+				// the frame may not get past its line, e.g. when it panicked at the end of a block, try its caller
+				v.logger.Debug().Err(err).Str("file", frame.Location.File).Int("line", nextLine).Msg("find next line")
+				continue
+			}
+			if breakpointAt(breakpoints, locations) {
+				found = true
+				break
+			}
+			name := fmt.Sprintf("gID%dL%d", debugState.SelectedGoroutine.ID, nextLine)
 			_, err = v.client.CreateBreakpoint(ctx, &api.Breakpoint{
-				Name: breakPointName,
+				Name: name,
 				File: frame.Location.File,
 				Line: nextLine,
 				Cond: fmt.Sprintf("runtime.curg.goid == %d", debugState.SelectedGoroutine.ID),
 			})
 			if err != nil {
-				return nil, true, fmt.Errorf("goroutine: %d, create breakpoint: %s: %w", debugState.SelectedGoroutine.ID, breakPointName, err)
+				return nil, true, fmt.Errorf("create breakpoint: %s: %w", name, err)
 			}
+			breakPointName, found = name, true
 			break
 		}
 	}
-	if breakPointName == "" {
+	if !found {
 		return nil, true, errNoMain
 	}
 	debugState, err = v.client.Continue(ctx)
@@ -322,6 +704,9 @@ func (v *Serializer) continueToFirstFrameInMainDotGo(ctx context.Context, debugS
 	if debugState.Exited {
 		return debugState, true, nil
 	}
+	if breakPointName == "" {
+		return debugState, false, nil
+	}
 	_, err = v.client.ClearBreakpointByName(ctx, breakPointName)
 	if err != nil {
 		return nil, true, fmt.Errorf("clear breakpoint: %w", err)
@@ -329,6 +714,19 @@ func (v *Serializer) continueToFirstFrameInMainDotGo(ctx context.Context, debugS
 	return debugState, false, nil
 }
 
+// breakpointAt checks if one of the breakpoints stops at one of the locations
+func breakpointAt(breakpoints []*api.Breakpoint, locations []api.Location) bool {
+	for _, location := range locations {
+		pcs := append([]uint64{location.PC}, location.PCs...)
+		for _, breakpoint := range breakpoints {
+			if slices.ContainsFunc(pcs, func(pc uint64) bool { return slices.Contains(breakpoint.Addrs, pc) }) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // getNextLine takes a file and line of current statement and returns the next line that has statement
 func (v *Serializer) getNextLine(filePath string, currentLine int) (int, error) {
 	file, err := os.Open(filePath)
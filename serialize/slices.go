@@ -0,0 +1,205 @@
+package serialize
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+// SliceHeader is the header of a slice held by a variable at a step
+type SliceHeader struct {
+	VariableFrame
+	// Name is the path to the slice from the variable holding it, e.g. "s", "p.items" or "grid[1]"
+	Name     string `json:"name"`
+	DeclLine int64  `json:"declLine,omitempty"`
+	// Base is the address of the first element in the backing array, 0 for nil slices
+	Base uint64 `json:"base"`
+	Len  int64  `json:"len"`
+	Cap  int64  `json:"cap"`
+	// Array numbers the backing arrays of the step from 1, slices sharing a backing array have the same number
+	Array int `json:"array,omitempty"`
+	// Reallocated is set when the slice moved to a new backing array since its frame was last seen,
+	// as append does when the capacity is exceeded, PreviousBase and PreviousCap describe the old array
+	Reallocated  bool   `json:"reallocated,omitempty"`
+	PreviousBase uint64 `json:"previousBase,omitempty"`
+	PreviousCap  int64  `json:"previousCap,omitempty"`
+}
+
+// sliceKey identifies a slice across steps by the frame and the variable holding it
+type sliceKey struct {
+	frame    frameKey
+	function string
+	name     string
+	declLine int64
+}
+
+// sliceArray is the part of a backing array a slice can reach
+type sliceArray struct {
+	base, cap uint64
+	elemSize  uint64
+}
+
+func (a sliceArray) end() uint64 {
+	return a.base + a.cap*a.elemSize
+}
+
+// contains checks if the address falls in the array, arrays of unknown element size only hold their base
+func (a sliceArray) contains(address uint64) bool {
+	return address == a.base || a.base <= address && address < a.end()
+}
+
+// AnnotateSlices sets Slices on every step to the slices held by the variables of the frames compared by
+// AnnotateChanges and by the package variables, including the slices in struct fields, behind pointers and
+// in the elements of arrays and slices. Slices reaching into the same backing array are grouped and the ones
+// that moved out of their previous backing array are marked as reallocated.
+func AnnotateSlices(steps []Step) {
+	previous := map[sliceKey]sliceArray{}
+	sizes := elemSizes(steps)
+	for i := range steps {
+		step := &steps[i]
+		step.Slices = nil
+		var arrays []sliceArray
+		forEachFrame(step, func(at variableFrame, vars []api.Variable) {
+			for j := range vars {
+				walkVariables(&vars[j], vars[j].Name, func(name string, variable *api.Variable) {
+					if reflect.Kind(variable.Kind) != reflect.Slice {
+						return
+					}
+					header := SliceHeader{
+						VariableFrame: at.VariableFrame,
+						Name:          name,
+						DeclLine:      vars[j].DeclLine,
+						Base:          variable.Base,
+						Len:           variable.Len,
+						Cap:           variable.Cap,
+					}
+					array := sliceArray{base: variable.Base, cap: uint64(variable.Cap), elemSize: sizes[elemType(variable)]}
+					key := sliceKey{frame: at.key, function: at.Function, name: name, declLine: header.DeclLine}
+					if last, ok := previous[key]; ok && last.base != 0 && header.Base != 0 && !last.contains(header.Base) {
+						header.Reallocated, header.PreviousBase, header.PreviousCap = true, last.base, int64(last.cap)
+					}
+					previous[key] = array
+					step.Slices = append(step.Slices, header)
+					arrays = append(arrays, array)
+				})
+			}
+		})
+		groupSlices(step.Slices, arrays)
+	}
+}
+
+// walkVariables calls fn for the variable and every variable reachable from it through the elements of
+// arrays and slices, the fields of structs and pointers, name is the path to the visited variable
+func walkVariables(variable *api.Variable, name string, fn func(name string, variable *api.Variable)) {
+	fn(name, variable)
+	switch reflect.Kind(variable.Kind) {
+	case reflect.Slice, reflect.Array:
+		for i := range variable.Children {
+			walkVariables(&variable.Children[i], fmt.Sprintf("%s[%d]", name, i), fn)
+		}
+	case reflect.Struct:
+		for i := range variable.Children {
+			walkVariables(&variable.Children[i], name+"."+variable.Children[i].Name, fn)
+		}
+	case reflect.Pointer:
+		if len(variable.Children) == 1 {
+			pointee := name
+			if reflect.Kind(variable.Children[0].Kind) != reflect.Struct {
+				pointee = "*" + name
+			}
+			walkVariables(&variable.Children[0], pointee, fn)
+		}
+	}
+}
+
+// groupSlices numbers the backing arrays, the slices whose arrays overlap share a number
+func groupSlices(headers []SliceHeader, arrays []sliceArray) {
+	groups := make([]int, len(arrays))
+	for i := range groups {
+		groups[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if groups[i] != i {
+			groups[i] = find(groups[i])
+		}
+		return groups[i]
+	}
+	// empty arrays may all share the address of the runtime's zero sized allocations
+	grouped := func(i int) bool { return arrays[i].base != 0 && arrays[i].cap != 0 }
+	for i := range arrays {
+		for j := range i {
+			if !grouped(i) || !grouped(j) {
+				continue
+			}
+			if arrays[i].contains(arrays[j].base) || arrays[j].contains(arrays[i].base) {
+				groups[find(i)] = find(j)
+			}
+		}
+	}
+	numbers := map[int]int{}
+	for i := range headers {
+		if !grouped(i) {
+			continue
+		}
+		root := find(i)
+		if _, ok := numbers[root]; !ok {
+			numbers[root] = len(numbers) + 1
+		}
+		headers[i].Array = numbers[root]
+	}
+}
+
+// elemSizes returns the sizes of the element types of the slices and arrays of the steps, derived from the
+// stride between the addresses of their loaded elements, so a slice with less than two elements loaded gets
+// the size from another slice or array of the same element type. The types never seen with two elements
+// loaded are left out.
+func elemSizes(steps []Step) map[string]uint64 {
+	sizes := map[string]uint64{}
+	for i := range steps {
+		forEachFrame(&steps[i], func(_ variableFrame, vars []api.Variable) {
+			for j := range vars {
+				walkVariables(&vars[j], vars[j].Name, func(_ string, variable *api.Variable) {
+					if size := stride(variable); size != 0 {
+						sizes[elemType(variable)] = size
+					}
+				})
+			}
+		})
+	}
+	return sizes
+}
+
+// stride returns the distance between the first two loaded elements of a slice or an array, 0 when there are
+// not two elements loaded at real addresses
+func stride(variable *api.Variable) uint64 {
+	kind := reflect.Kind(variable.Kind)
+	if kind != reflect.Slice && kind != reflect.Array || len(variable.Children) < 2 {
+		return 0
+	}
+	first, second := variable.Children[0], variable.Children[1]
+	if (first.Flags|second.Flags)&api.VariableFakeAddress != 0 || second.Addr <= first.Addr {
+		return 0
+	}
+	return second.Addr - first.Addr
+}
+
+// elemType returns the element type of a slice or an array type, e.g. "int" for "[]int" and "[4]int"
+func elemType(variable *api.Variable) string {
+	_, elem, _ := strings.Cut(variable.RealType, "]")
+	return elem
+}
+
+// reallocationDetails describes the slices of the current frame or of the package moved to a new backing array at the step
+func reallocationDetails(step *Step) []string {
+	goroutine := step.GoroutinesData[0].Goroutine.ID
+	var details []string
+	for _, slice := range step.Slices {
+		if slice.Reallocated && (slice.Goroutine == 0 || slice.Goroutine == goroutine && slice.Frame == 0) {
+			details = append(details, fmt.Sprintf("%s moved to a new backing array (cap %d -> %d)", slice.Name, slice.PreviousCap, slice.Cap))
+		}
+	}
+	return details
+}
@@ -0,0 +1,84 @@
+package serialize
+
+import (
+	"testing"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+func intSliceVar(name string, base uint64, length, capacity int64) api.Variable {
+	return api.Variable{Name: name, Type: "[]int", RealType: "[]int", Kind: 23, Base: base, Len: length, Cap: capacity}
+}
+
+// withElements loads the elements of the slice at the given stride
+func withElements(slice api.Variable, stride uint64) api.Variable {
+	for i := range uint64(slice.Len) {
+		slice.Children = append(slice.Children, api.Variable{Type: "int", RealType: "int", Kind: 2, Addr: slice.Base + i*stride})
+	}
+	return slice
+}
+
+func TestAnnotateSlices(t *testing.T) {
+	steps := []Step{
+		// the size of the elements is derived from the addresses of the elements loaded here
+		newTestStep(1, "main.main", 7, withElements(intSliceVar("a", 0x1000, 2, 3), 8)),
+		newTestStep(1, "main.main", 8, intSliceVar("a", 0x1000, 2, 3), intSliceVar("b", 0x1008, 1, 2)),
+		newTestStep(1, "main.main", 9, intSliceVar("a", 0x2000, 4, 6), intSliceVar("b", 0x1008, 1, 2)),
+		newTestStep(1, "main.main", 10, intSliceVar("a", 0x2008, 3, 5), intSliceVar("b", 0x1008, 1, 2)),
+	}
+	AnnotateSlices(steps)
+
+	if got := steps[1].Slices; len(got) != 2 || got[0].Array != 1 || got[1].Array != 1 {
+		t.Errorf("a and b don't share their array: %+v", got)
+	}
+	realloc := steps[2].Slices[0]
+	if !realloc.Reallocated || realloc.PreviousBase != 0x1000 || realloc.PreviousCap != 3 {
+		t.Errorf("a isn't marked as reallocated: %+v", realloc)
+	}
+	if steps[2].Slices[0].Array == steps[2].Slices[1].Array {
+		t.Errorf("a and b still share their array: %+v", steps[2].Slices)
+	}
+	if steps[3].Slices[0].Reallocated {
+		t.Errorf("reslicing a is marked as a reallocation: %+v", steps[3].Slices[0])
+	}
+}
+
+func TestAnnotateSlicesElemSize(t *testing.T) {
+	// 4 bytes elements, as on a 32-bit platform or for []int32
+	a := withElements(intSliceVar("a", 0x1000, 2, 4), 4)
+	b := intSliceVar("b", 0x100c, 1, 1)
+	// past the 4 elements of a's array
+	c := intSliceVar("c", 0x1010, 1, 1)
+	// nothing tells the size of the elements of []string here, only the slices at the same base share their array
+	s := api.Variable{Name: "s", Type: "[]string", RealType: "[]string", Kind: 23, Base: 0x3000, Len: 1, Cap: 4}
+	u := api.Variable{Name: "u", Type: "[]string", RealType: "[]string", Kind: 23, Base: 0x3010, Len: 1, Cap: 1}
+	steps := []Step{newTestStep(1, "main.main", 7, a, b, c, s, u)}
+	AnnotateSlices(steps)
+
+	got := steps[0].Slices
+	if got[0].Array != got[1].Array {
+		t.Errorf("a and b don't share their array: %+v", got)
+	}
+	if got[0].Array == got[2].Array {
+		t.Errorf("a and c share their array: %+v", got)
+	}
+	if got[3].Array == got[4].Array {
+		t.Errorf("s and u share their array without a known element size: %+v", got)
+	}
+}
+
+func TestWalkVariables(t *testing.T) {
+	items := intSliceVar("items", 0x1000, 0, 4)
+	list := api.Variable{Name: "", Kind: 25, Children: []api.Variable{items}}
+	pointer := api.Variable{Name: "l", Kind: 22, Children: []api.Variable{list}}
+
+	var names []string
+	walkVariables(&pointer, pointer.Name, func(name string, variable *api.Variable) {
+		if variable.Kind == 23 {
+			names = append(names, name)
+		}
+	})
+	if len(names) != 1 || names[0] != "l.items" {
+		t.Errorf("got slices %v, want [l.items]", names)
+	}
+}
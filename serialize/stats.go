@@ -0,0 +1,36 @@
+package serialize
+
+import "path/filepath"
+
+// ExecutionStats holds how often each line and function was executed during the trace
+type ExecutionStats struct {
+	// LineHits maps a file to the number of steps recorded at each of its lines
+	LineHits map[string]map[int]int `json:"lineHits"`
+	// FunctionCalls maps a function name to the number of times it was called
+	FunctionCalls map[string]int `json:"functionCalls"`
+}
+
+// ComputeStats counts the line hits and function calls of the given steps,
+// only the goroutine that advanced in each step is counted
+func ComputeStats(steps []Step) ExecutionStats {
+	stats := ExecutionStats{
+		LineHits:      map[string]map[int]int{},
+		FunctionCalls: map[string]int{},
+	}
+	tracker := newCallTracker()
+	for i := range steps {
+		data := &steps[i].GoroutinesData[0]
+		loc := data.Goroutine.CurrentLoc
+		file := filepath.Base(loc.File)
+		if stats.LineHits[file] == nil {
+			stats.LineHits[file] = map[int]int{}
+		}
+		stats.LineHits[file][loc.Line]++
+
+		stack, _, firstCall := tracker.advance(data)
+		for _, called := range stack[firstCall:] {
+			stats.FunctionCalls[called.function]++
+		}
+	}
+	return stats
+}
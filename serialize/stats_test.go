@@ -0,0 +1,71 @@
+package serialize
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/go-delve/delve/service/api"
+)
+
+func TestComputeStatsLineHits(t *testing.T) {
+	steps := newCountSteps()
+	// a step of a library stepped into is counted under its own file
+	library := api.Location{File: "/usr/local/go/src/sort/sort.go", Line: 48, Function: &api.Function{Name_: "sort.Ints"}}
+	steps = append(steps, Step{GoroutinesData: []GoRoutineData{{
+		Goroutine:  &api.Goroutine{ID: 1, CurrentLoc: library},
+		Stacktrace: []api.Stackframe{{Location: library}, frameAt("main.main", 9)},
+	}}})
+
+	stats := ComputeStats(steps)
+	want := map[string]map[int]int{
+		"main.go": {7: 3, 8: 2},
+		"sort.go": {48: 1},
+	}
+	if !reflect.DeepEqual(stats.LineHits, want) {
+		t.Errorf("got line hits %v, want %v", stats.LineHits, want)
+	}
+}
+
+func TestComputeStatsFunctionCalls(t *testing.T) {
+	main := frameAt("main.main", 10)
+	work := func(line int) api.Stackframe { return frameAt("main.work", line) }
+	worker := func(id int64, frames ...api.Stackframe) Step {
+		step := newStackStep(frames...)
+		step.GoroutinesData[0].Goroutine.ID = id
+		return step
+	}
+	steps := []Step{
+		newStackStep(main),
+		newStackStep(work(4), main),
+		newStackStep(work(5), main),
+		newStackStep(main),
+		// the same function called again from the same line
+		newStackStep(work(4), main),
+		newStackStep(main),
+		// another goroutine running the function is a call of its own
+		worker(2, work(4)),
+		worker(2, work(5)),
+	}
+
+	stats := ComputeStats(steps)
+	want := map[string]int{"main.main": 1, "main.work": 3}
+	if !reflect.DeepEqual(stats.FunctionCalls, want) {
+		t.Errorf("got function calls %v, want %v", stats.FunctionCalls, want)
+	}
+}
+
+func TestComputeStatsEmptyTrace(t *testing.T) {
+	stats := ComputeStats(nil)
+	if len(stats.LineHits) != 0 || len(stats.FunctionCalls) != 0 {
+		t.Errorf("got %+v for an empty trace", stats)
+	}
+	// clients read the maps without checking for null
+	out, err := json.Marshal(stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"lineHits":{},"functionCalls":{}}`; string(out) != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+}
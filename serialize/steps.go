@@ -1,6 +1,9 @@
 package serialize
 
 import (
+	"slices"
+	"time"
+
 	"github.com/go-delve/delve/service/api"
 )
 
@@ -11,16 +14,89 @@ type ExecutionResponse struct {
 	StdErr      string `json:"stderr"`
 	StdOutBytes []byte `json:"stdoutBytes"`
 	StdErrBytes []byte `json:"stderrBytes"`
+	// Metadata describes how the trace was recorded, StdOut and StdErr are stripped of the playback headers
+	// of faketime while StdOutBytes and StdErrBytes keep them
+	Metadata *Metadata `json:"metadata,omitempty"`
+	// Stats is only set when requested through Options.Stats
+	Stats *ExecutionStats `json:"stats,omitempty"`
+	// CallTree is only set when requested through Options.CallTree
+	CallTree []*CallNode `json:"callTree,omitempty"`
+	// Races holds the data races reported when the program is built with the race detector
+	Races []DataRace `json:"races,omitempty"`
+	// Leaks holds the user goroutines that were still alive when main returned
+	Leaks []LeakedGoroutine `json:"leaks,omitempty"`
+	// Diagnostics holds the escape analysis and inlining decisions of the compiler for main.go
+	Diagnostics []CompilerDiagnostic `json:"diagnostics,omitempty"`
+	// Disassembly holds the instructions of the functions of main.go that ran, by function name,
+	// only set when requested through Options.Disassemble
+	Disassembly map[string][]Instruction `json:"disassembly,omitempty"`
+}
+
+// Clone returns a copy of the response whose steps can be collapsed and annotated without changing
+// the original, e.g. a response shared through a cache. The goroutines and variables are shared, they are only read.
+func (r ExecutionResponse) Clone() ExecutionResponse {
+	r.Steps = slices.Clone(r.Steps)
+	r.Races = slices.Clone(r.Races)
+	return r
 }
 
 type GoRoutineData struct {
 	Goroutine  *api.Goroutine
 	Stacktrace []api.Stackframe
+	// LibraryFrames holds the indexes in Stacktrace of the frames in the standard library packages stepped into
+	LibraryFrames []int `json:",omitempty"`
+	// Defers lists the pending deferred calls of the frames in main.go and in the libraries stepped into,
+	// from the top frame down and in the order they will run within a frame, only set for the stepped goroutine
+	Defers []DeferredCall `json:",omitempty"`
 }
 
 type Step struct {
 	PackageVariables []api.Variable
 	GoroutinesData   []GoRoutineData
+	// StdOut and StdErr hold the output the program emitted since the previous step
+	StdOut string `json:",omitempty"`
+	StdErr string `json:",omitempty"`
+	// ReturnValues holds the values returned by the function the goroutine just returned from
+	ReturnValues []api.Variable `json:",omitempty"`
+	// Deadlock is only set on the final step of a program the runtime found deadlocked
+	Deadlock *Deadlock `json:",omitempty"`
+	// FatalError is only set on the final step of a program the runtime threw a fatal error other than a deadlock in,
+	// e.g. "concurrent map writes", the runtime's report is in StdErr
+	FatalError string `json:",omitempty"`
+	// Races holds the indexes in ExecutionResponse.Races of the data races with an access in this step
+	Races []int `json:",omitempty"`
+	// Diagnostics holds the indexes in ExecutionResponse.Diagnostics of the compiler diagnostics of the step's line
+	Diagnostics []int `json:",omitempty"`
+	// Changes lists the variables that were created, changed or went out of scope since the previous step
+	Changes []VariableChange `json:",omitempty"`
+	// Slices lists the headers of the slices held by the variables, grouped by backing array
+	Slices []SliceHeader `json:",omitempty"`
+	// Closures lists the function values held by the variables along with the variables they captured
+	Closures []Closure `json:",omitempty"`
+	// Interfaces lists the interface values held by the variables with their dynamic types and methods
+	Interfaces []InterfaceValue `json:",omitempty"`
+	// Formatted lists the views of the variables made by the formatters, e.g. a linked list shown as a list
+	Formatted []FormattedValue `json:",omitempty"`
+	// Scopes tells the declaring block of the arguments and locals and whether they shadow or are shadowed
+	Scopes []VariableScope `json:",omitempty"`
+	// Truncated lists the variables that were cut off by the load limits and can be expanded with ExpandVariable
+	Truncated []TruncatedVariable `json:",omitempty"`
+	// VirtualTime is how far the clock of the program moved since it started, in nanoseconds,
+	// only set when it's built with -tags=faketime where the clock only moves when all goroutines sleep
+	VirtualTime *time.Duration `json:",omitempty"`
+	// Scheduler is the state of the OS threads and processors at the step, only set with Options.Scheduler
+	Scheduler *Scheduler `json:",omitempty"`
+	// Assembly references the instructions of the step's line in ExecutionResponse.Disassembly
+	Assembly *AssemblyRef `json:",omitempty"`
+	// MemStats is the heap and GC statistics at the step, only set for the steps sampled with Options.MemStats
+	MemStats *MemStats `json:",omitempty"`
+	// Loop is the iteration of the innermost loop the step runs in, only set when loops are collapsed
+	Loop *LoopIteration `json:",omitempty"`
+	// CollapsedLoop summarizes the loop iterations dropped from the trace right after this step
+	CollapsedLoop *LoopSummary `json:",omitempty"`
+	// DeferredCall is the deferred call that started running at this step, during a function exit or a panic,
+	// only set for the deferred functions that are recorded, i.e. in main.go or in the libraries stepped into
+	DeferredCall *DeferredCall `json:",omitempty"`
 }
 
 func (s *Step) isValid() bool {